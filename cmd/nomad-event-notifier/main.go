@@ -2,25 +2,50 @@ package main
 
 import (
 	"context"
+	"errors"
+	_ "expvar"
+	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
 
 	"github.com/ttys3/nomad-event-notifier/internal/bot"
+	"github.com/ttys3/nomad-event-notifier/internal/config"
+	"github.com/ttys3/nomad-event-notifier/internal/store"
 	"github.com/ttys3/nomad-event-notifier/internal/stream"
 	"github.com/ttys3/nomad-event-notifier/version"
 )
 
 func main() {
 	fmt.Printf("%s %s %s\n", version.ServiceName, version.Version, version.BuildTime)
-	os.Exit(realMain())
+	os.Exit(realMain(os.Args[1:]))
 }
 
-func realMain() int {
+const usage = `Usage: nomad-event-notifier [-config <file>]
+       nomad-event-notifier validate <file>
+
+Without -config (or CONFIG_FILE) the configuration is read from env vars.
+`
+
+func realMain(args []string) int {
+	if len(args) > 0 && args[0] == "validate" {
+		return validateMain(args[1:])
+	}
+
+	flags := flag.NewFlagSet("nomad-event-notifier", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "HCL configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
 	ctx, closer := CtxWithInterrupt(context.Background())
 	defer closer()
 
@@ -33,34 +58,75 @@ func realMain() int {
 	}))
 	slog.SetDefault(logger)
 
-	botCfg := bot.Config{
-		Token:      os.Getenv("SLACK_TOKEN"),
-		Channel:    os.Getenv("SLACK_CHANNEL"),
-		WebhookURL: os.Getenv("DISCORD_WEBHOOK_URL"),
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	botCfg := cfg.BotConfig()
+
+	streamCfg := cfg.StreamConfig()
+	// persist state such as the last processed event index, so restarts do not miss events
+	if cfg.DataDir != "" {
+		cp, err := stream.NewFileCheckpoint(filepath.Join(cfg.DataDir, "index.json"))
+		if err != nil {
+			panic(err)
+		}
+		streamCfg.Checkpoint = cp
 	}
 
-	config := api.DefaultConfig()
-	s, err := stream.NewStream(config)
+	config := cfg.NomadConfig()
+	s, err := stream.NewStream(config, streamCfg)
 	if err != nil {
 		panic(err)
 	}
 
+	nomadClient, err := api.NewClient(config)
+	if err != nil {
+		panic(err)
+	}
+	botCfg.Nomad = nomadClient
+
+	msgStore, err := newMessageStore(nomadClient, cfg)
+	if err != nil {
+		panic(err)
+	}
+	defer msgStore.Close()
+	botCfg.Store = msgStore
+	go store.RunJanitor(ctx, msgStore, time.Minute)
+
 	s.L.Info("new stream created", "config", config)
 
 	// for user click in Slack to open the link
-	nomadServerExternalURL := os.Getenv("NOMAD_SERVER_EXTERNAL_URL")
-	if nomadServerExternalURL == "" {
-		nomadServerExternalURL = config.Address
-		s.L.Info("using default nomad server external URL since NOMAD_SERVER_EXTERNAL_URL is empty",
-			"nomad_url", nomadServerExternalURL)
-	}
+	nomadServerExternalURL := cfg.ExternalURL(config)
 
 	b, err := bot.NewBot(botCfg, nomadServerExternalURL)
 	if err != nil {
 		panic(err)
 	}
+	// mails pending digests on shutdown
+	defer func() {
+		if err := b.Close(); err != nil {
+			slog.Error("error closing bots", "error", err)
+		}
+	}()
 	s.L.Info("new slack bot created", "botCfg", botCfg)
 
+	// metrics are published via expvar at /debug/vars,
+	// bots add their callback endpoints such as the slack interactivity request URL
+	if cfg.HTTPAddr != "" {
+		b.RegisterHandlers(http.DefaultServeMux)
+		go serveHTTP(ctx, cfg.HTTPAddr, http.DefaultServeMux)
+	} else {
+		for _, slackCfg := range botCfg.Slack {
+			if slackCfg.SigningSecret != "" {
+				s.L.Warn("slack signing secret is set but http_addr is empty, Promote / Fail buttons will not work",
+					"instance", slackCfg.Name)
+			}
+		}
+	}
+
 	s.L.Info("begin subscribe event stream")
 	s.Subscribe(ctx, b)
 	s.L.Info("end subscribe event stream")
@@ -68,6 +134,65 @@ func realMain() int {
 	return 0
 }
 
+func loadConfig(file string) (*config.Config, error) {
+	if file == "" {
+		return config.FromEnv()
+	}
+	return config.Load(file)
+}
+
+// validateMain checks a configuration file without connecting to nomad or any backend.
+func validateMain(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	if _, err := config.Load(args[0]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("configuration %s is valid\n", args[0])
+	return 0
+}
+
+// newMessageStore creates the store for posted message IDs, "memory", "bolt" (a file in the data dir)
+// or "nomad" (Nomad Variables).
+func newMessageStore(client *api.Client, cfg *config.Config) (store.MessageStore, error) {
+	switch s := cfg.MessageStore; s.Type {
+	case "memory":
+		return store.NewMemory(map[string]int{store.KindAllocation: s.MaxAllocations}), nil
+	case "bolt":
+		if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+			return nil, fmt.Errorf("error creating data dir: %w", err)
+		}
+		return store.NewBolt(filepath.Join(cfg.DataDir, "messages.db"))
+	case "nomad":
+		return store.NewNomadVariables(client, s.NomadPrefix, s.NomadNamespace), nil
+	default:
+		return nil, fmt.Errorf("unknown message store %q", s.Type)
+	}
+}
+
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("http server listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("http server failed", "addr", addr, "error", err)
+	}
+}
+
 func CtxWithInterrupt(ctx context.Context) (context.Context, func()) {
 	ctx, cancel := context.WithCancel(ctx)
 
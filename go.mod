@@ -5,9 +5,12 @@ go 1.22
 require (
 	github.com/bwmarrin/discordgo v0.28.1
 	github.com/go-resty/resty/v2 v2.13.1
+	github.com/hashicorp/go-bexpr v0.1.14
+	github.com/hashicorp/hcl/v2 v2.20.1
 	github.com/hashicorp/nomad v1.7.6
 	github.com/hashicorp/nomad/api v0.0.0-20240416061655-9d4f7bcb68c5
 	github.com/slack-go/slack v0.13.0
+	go.etcd.io/bbolt v1.3.11
 )
 
 require (
@@ -27,7 +30,6 @@ require (
 	github.com/hashicorp/consul/api v1.28.2 // indirect
 	github.com/hashicorp/cronexpr v1.1.2 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
-	github.com/hashicorp/go-bexpr v0.1.14 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
 	github.com/hashicorp/go-hclog v1.6.3 // indirect
 	github.com/hashicorp/go-immutable-radix v1.3.1 // indirect
@@ -47,7 +49,6 @@ require (
 	github.com/hashicorp/golang-lru v1.0.2 // indirect
 	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
 	github.com/hashicorp/hcl v1.0.1-vault-5 // indirect
-	github.com/hashicorp/hcl/v2 v2.20.1 // indirect
 	github.com/hashicorp/memberlist v0.5.1 // indirect
 	github.com/hashicorp/raft v1.6.1 // indirect
 	github.com/hashicorp/raft-autopilot v0.2.0 // indirect
@@ -4,36 +4,336 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+	"github.com/ttys3/nomad-event-notifier/internal/store"
 )
 
-type Config struct {
+// Instance is the configuration common to all backend instances.
+type Instance struct {
+	// Name identifies the instance, it must be unique across all backends
+	Name string
+	// Kinds limits the notification kinds sent to the instance, e.g. KindDeployment, all if empty
+	Kinds []string
+}
+
+// accepts reports whether notifications of kind are sent to the instance.
+func (i Instance) accepts(kind string) bool {
+	if len(i.Kinds) == 0 {
+		return true
+	}
+	for _, k := range i.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type SlackConfig struct {
+	Instance
 	// You more than likely want your "Bot User OAuth Access Token" which starts with "xoxb-"
+	Token   string
+	Channel string
+	// SigningSecret enables the Promote / Fail buttons of slack messages,
+	// it verifies the requests slack sends to the interactivity endpoint
+	SigningSecret string
+}
+
+type DiscordConfig struct {
+	Instance
 	WebhookURL string
-	Token      string
-	Channel    string
+}
+
+type TeamsConfig struct {
+	Instance
+	// WebhookURL is the URL of a teams incoming webhook
+	WebhookURL string
+}
+
+type MattermostConfig struct {
+	Instance
+	// URL is the address of the mattermost server, e.g. https://mattermost.example.com
+	URL string
+	// Token is a bot or personal access token
+	Token     string
+	ChannelID string
+}
+
+type TelegramConfig struct {
+	Instance
+	Token string
+	// ChatID is the chat or channel to post to, e.g. -1001234567890 or @channelname
+	ChatID string
+	// ParseMode is "HTML" or "MarkdownV2", defaults to HTML
+	ParseMode string
+	// APIURL defaults to https://api.telegram.org
+	APIURL string
+}
+
+type WebhookConfig struct {
+	Instance
+	URL string
+	// Secret signs the requests with HMAC-SHA256 if set
+	Secret  string
+	Headers map[string]string
+	// Timeout of a request, defaults to 10s
+	Timeout time.Duration
+}
+
+type SMTPConfig struct {
+	Instance
+	Host string
+	// Port defaults to 587 for starttls, 465 for tls and 25 otherwise
+	Port int
+	// TLS is "starttls" (default), "tls" for implicit TLS or "none"
+	TLS string
+	// TLSCAFile is a PEM file with the CAs to verify the server with instead of the system ones
+	TLSCAFile string
+	// InsecureSkipVerify disables verifying the certificate of the server
+	InsecureSkipVerify bool
+
+	Username string
+	Password string
+	From     string
+	// To get all mails
+	To []string
+	// Recipients get the mails matching their conditions
+	Recipients []SMTPRecipient
+	// Digest collects the mails of each recipient and sends them together every interval, if set
+	Digest time.Duration
+}
+
+type SMTPRecipient struct {
+	Address string
+	// Match are the conditions of the recipient, its targets are ignored
+	Match Route
+}
+
+type PagerDutyConfig struct {
+	Instance
+	// RoutingKey is the integration key of an Events API v2 integration
+	RoutingKey string
+	// APIURL defaults to https://events.pagerduty.com
+	APIURL string
+}
+
+type OpsgenieConfig struct {
+	Instance
+	APIKey string
+	// APIURL defaults to https://api.opsgenie.com, e.g. https://api.eu.opsgenie.com for the EU instance
+	APIURL string
+	// Priorities override the priority of the alerts by notification kind, e.g. "P1"
+	Priorities map[string]string
+}
+
+type MatrixConfig struct {
+	Instance
+	// HomeserverURL is the address of the client-server api, e.g. https://matrix.example.com
+	HomeserverURL string
+	// AccessToken of the user sending the messages, it must have joined the room
+	AccessToken string
+	// RoomID is the room to post to, e.g. !abcdefg:example.com
+	RoomID string
+}
+
+type GoogleChatConfig struct {
+	Instance
+	// WebhookURL is the URL of a google chat space webhook, including its key and token
+	WebhookURL string
+}
+
+type Config struct {
+	Slack      []SlackConfig
+	Discord    []DiscordConfig
+	Teams      []TeamsConfig
+	Mattermost []MattermostConfig
+	Telegram   []TelegramConfig
+	Webhook    []WebhookConfig
+	SMTP       []SMTPConfig
+	PagerDuty  []PagerDutyConfig
+	Opsgenie   []OpsgenieConfig
+	Matrix     []MatrixConfig
+	GoogleChat []GoogleChatConfig
+
+	// Routes select the instances of a notification, the first matching route wins unless it continues.
+	// Without routes all instances get every notification.
+	Routes []Route
+	// DefaultTargets are the instances of notifications matching no route, all instances if nil
+	DefaultTargets []string
+
+	// Classifier finds why allocations failed, defaults to classify.DefaultKinds
+	Classifier *classify.Classifier
+
+	// Nomad is the client used to act on nomad, e.g. promoting deployments
+	Nomad *api.Client
+
+	// Templates render deployment and allocation notifications, defaults to the built-in templates
+	Templates *Templates
+
+	// Store keeps the posted message IDs, defaults to an in-memory store
+	Store store.MessageStore
+	// DeployGrace is how long a deployment message is still updated
+	// after the deployment reached a terminal status, defaults to 1h
+	DeployGrace time.Duration
+	// AllocTTL is how long an allocation message is tracked, defaults to 24h
+	AllocTTL time.Duration
+}
+
+// LogValue hides credentials and clients when logging the config.
+func (c Config) LogValue() slog.Value {
+	var instances []string
+	for _, i := range c.instances() {
+		instances = append(instances, i.Name)
+	}
+	return slog.GroupValue(
+		slog.Any("instances", instances),
+		slog.Duration("deploy_grace", c.DeployGrace),
+		slog.Duration("alloc_ttl", c.AllocTTL),
+	)
+}
+
+// instances lists the instances of all backends.
+func (c Config) instances() []Instance {
+	var instances []Instance
+	for _, s := range c.Slack {
+		instances = append(instances, s.Instance)
+	}
+	for _, d := range c.Discord {
+		instances = append(instances, d.Instance)
+	}
+	for _, t := range c.Teams {
+		instances = append(instances, t.Instance)
+	}
+	for _, m := range c.Mattermost {
+		instances = append(instances, m.Instance)
+	}
+	for _, t := range c.Telegram {
+		instances = append(instances, t.Instance)
+	}
+	for _, w := range c.Webhook {
+		instances = append(instances, w.Instance)
+	}
+	for _, m := range c.SMTP {
+		instances = append(instances, m.Instance)
+	}
+	for _, p := range c.PagerDuty {
+		instances = append(instances, p.Instance)
+	}
+	for _, o := range c.Opsgenie {
+		instances = append(instances, o.Instance)
+	}
+	for _, m := range c.Matrix {
+		instances = append(instances, m.Instance)
+	}
+	for _, g := range c.GoogleChat {
+		instances = append(instances, g.Instance)
+	}
+	return instances
+}
+
+// maxDeployTTL bounds how long a running deployment is tracked,
+// in case we never see it reaching a terminal status.
+const maxDeployTTL = 7 * 24 * time.Hour
+
+func (c Config) deployTTL(deploy api.Deployment) time.Duration {
+	switch deploy.Status {
+	case api.DeploymentStatusSuccessful, api.DeploymentStatusFailed, api.DeploymentStatusCancelled:
+		return c.DeployGrace
+	default:
+		return maxDeployTTL
+	}
 }
 
 type Bot struct {
 	bots []Impl
-	L    *slog.Logger
+	// instances are the configurations of bots by name
+	instances    map[string]Instance
+	router       *router
+	nomad        *api.Client
+	nomadAddress string
+	cfg          Config
+	nodes        *nodeTracker
+	evals        *evalDeduper
+	jobs         *jobCache
+	L            *slog.Logger
+
+	// mu guards keys
+	mu sync.Mutex
+	// keys serializes sending per message key, so two notifications for the same key
+	// never both post a new message, while messages of other keys are still sent
+	keys map[store.Key]*keyLock
+}
+
+// keyLock is held while sending for one message key, refs counts the senders holding or waiting for it.
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
 }
 
 var errImplNotEnabled = errors.New("impl not available")
 
-type Creater = func(cfg Config, nomadAddress string) (Impl, error)
+// Creater creates all configured instances of one backend, errImplNotEnabled if there are none.
+type Creater = func(cfg Config, nomadAddress string) ([]Impl, error)
+
+// closer is implemented by bots holding notifications back, e.g. for a digest.
+type closer interface {
+	Close() error
+}
+
+// httpHandler is implemented by bots receiving callbacks from their platform.
+type httpHandler interface {
+	RegisterHandlers(mux *http.ServeMux)
+}
 
+// Impl renders notifications to the wire format of one backend.
 type Impl interface {
-	UpsertDeployMsg(deploy api.Deployment) error
-	UpsertAllocationMsg(alloc api.Allocation) error
+	// Name identifies the backend instance, e.g. in the keys of the message store
+	Name() string
+	// Type is the kind of backend, e.g. "slack", it selects the templates
+	Type() string
+	// Post sends n as a new message and returns its ID.
+	Post(n Notification) (messageID string, err error)
+}
+
+// Updater is implemented by backends able to edit a posted message in place,
+// notifications with the same key then update one message instead of posting new ones.
+type Updater interface {
+	Update(messageID string, n Notification) error
 }
 
 func NewBot(cfg Config, nomadAddress string) (*Bot, error) {
 	var bots []Impl
 
-	for _, c := range []Creater{NewDiscordBot, newSlackBot} {
-		bot, err := c(cfg, nomadAddress)
+	if cfg.Store == nil {
+		cfg.Store = store.NewMemory(nil)
+	}
+	if cfg.Classifier == nil {
+		cfg.Classifier = classify.New()
+	}
+	if cfg.Templates == nil {
+		templates, err := NewTemplates()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Templates = templates
+	}
+	if cfg.DeployGrace <= 0 {
+		cfg.DeployGrace = time.Hour
+	}
+	if cfg.AllocTTL <= 0 {
+		cfg.AllocTTL = 24 * time.Hour
+	}
+
+	for _, c := range []Creater{NewDiscordBot, newSlackBot, newTeamsBot, newMattermostBot, newTelegramBot, newWebhookBot, newSMTPBot, newPagerDutyBot, newOpsgenieBot, newMatrixBot, newGoogleChatBot} {
+		impls, err := c(cfg, nomadAddress)
 		if err != nil {
 			if errors.Is(err, errImplNotEnabled) {
 				continue
@@ -42,37 +342,293 @@ func NewBot(cfg Config, nomadAddress string) (*Bot, error) {
 			return nil, fmt.Errorf("failed to create bot: %w", err)
 		}
 
-		bots = append(bots, bot)
+		bots = append(bots, impls...)
 	}
 
 	if len(bots) == 0 {
 		return nil, errors.New("no bots enabled")
 	}
 
+	instances := make(map[string]Instance)
+	for _, i := range cfg.instances() {
+		if _, ok := instances[i.Name]; ok {
+			return nil, fmt.Errorf("duplicate backend instance name %q", i.Name)
+		}
+		instances[i.Name] = i
+	}
+
+	router, err := newRouter(cfg.Routes, cfg.DefaultTargets, instances)
+	if err != nil {
+		return nil, err
+	}
+
 	bot := &Bot{
-		bots: bots,
-		L:    slog.Default(),
+		bots:         bots,
+		instances:    instances,
+		router:       router,
+		nomad:        cfg.Nomad,
+		nomadAddress: nomadAddress,
+		cfg:          cfg,
+		nodes:        newNodeTracker(),
+		evals:        newEvalDeduper(evalDedupeTTL),
+		jobs:         newJobCache(),
+		L:            slog.Default(),
 	}
+	bot.seedNodes()
 
 	return bot, nil
 }
 
-func (b *Bot) UpsertDeployMsg(deploy api.Deployment) error {
-	var err error
+// seedNodes reads the nodes, so changes of nodes are noticed from their first event on.
+func (b *Bot) seedNodes() {
+	if b.nomad == nil {
+		return
+	}
+	nodes, _, err := b.nomad.Nodes().List(nil)
+	if err != nil {
+		b.L.Warn("error reading nodes, first changes of each node are only partly noticed", "error", err)
+		return
+	}
+	b.nodes.seed(nodes)
+}
 
+// RegisterHandlers registers the callback endpoints of all bots on mux.
+func (b *Bot) RegisterHandlers(mux *http.ServeMux) {
 	for _, bot := range b.bots {
-		err = errors.Join(err, bot.UpsertDeployMsg(deploy))
+		if h, ok := bot.(httpHandler); ok {
+			h.RegisterHandlers(mux)
+		}
 	}
+}
 
+// Close sends the notifications bots still hold back, it is called on shutdown.
+func (b *Bot) Close() error {
+	var err error
+	for _, bot := range b.bots {
+		if c, ok := bot.(closer); ok {
+			if closeErr := c.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("%s: %w", bot.Name(), closeErr))
+			}
+		}
+	}
 	return err
 }
 
-func (b *Bot) UpsertAllocationMsg(alloc api.Allocation) error {
+// send delivers n to all bots.
+func (b *Bot) send(n Notification) error {
 	var err error
 
+	targets := b.router.targets(n)
 	for _, bot := range b.bots {
-		err = errors.Join(err, bot.UpsertAllocationMsg(alloc))
+		if targets != nil && !targets[bot.Name()] {
+			continue
+		}
+		if !b.instances[bot.Name()].accepts(n.Kind) {
+			continue
+		}
+		if sendErr := b.sendTo(bot, n); sendErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", bot.Name(), sendErr))
+		}
 	}
 
 	return err
 }
+
+// sendTo updates the message posted for the key of n if the bot can, or posts a new one.
+func (b *Bot) sendTo(bot Impl, n Notification) error {
+	if err := b.cfg.Templates.apply(bot.Type(), &n); err != nil {
+		return err
+	}
+
+	updater, ok := bot.(Updater)
+	if !ok || n.Key == "" {
+		_, err := bot.Post(n)
+		return err
+	}
+
+	key := store.Key{Backend: bot.Name(), Kind: n.Kind, ID: n.Key}
+	unlock := b.lockKey(key)
+	defer unlock()
+
+	messageID, found, err := b.cfg.Store.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if found && messageID != "" {
+		b.L.Debug("existing message found, updating", "bot", bot.Name(), "key", key, "message_id", messageID)
+		if err := updater.Update(messageID, n); err != nil {
+			return err
+		}
+	} else {
+		b.L.Debug("no existing message found, creating new message", "bot", bot.Name(), "key", key)
+		if messageID, err = bot.Post(n); err != nil {
+			return err
+		}
+	}
+
+	return b.cfg.Store.Set(key, messageID, n.TTL)
+}
+
+// lockKey waits until no other notification for key is being sent, the returned func releases it.
+// b.mu is only held to find the lock of key, never while talking to a backend.
+func (b *Bot) lockKey(key store.Key) (unlock func()) {
+	b.mu.Lock()
+	if b.keys == nil {
+		b.keys = make(map[store.Key]*keyLock)
+	}
+	l := b.keys[key]
+	if l == nil {
+		l = &keyLock{}
+		b.keys[key] = l
+	}
+	l.refs++
+	b.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(b.keys, key)
+		}
+	}
+}
+
+func (b *Bot) UpsertDeployMsg(deploy api.Deployment) error {
+	job := b.lookupJobVersion(deploy.Namespace, deploy.JobID, deploy.JobVersion)
+	n := deploymentNotification(deploy, job, b.nomadAddress)
+	n.TTL = b.cfg.deployTTL(deploy)
+	return b.send(n)
+}
+
+// lookupJob reads the job for templates and routing, nil if it can not be read.
+func (b *Bot) lookupJob(namespace, jobID string) *api.Job {
+	if b.nomad == nil {
+		return nil
+	}
+	job, _, err := b.nomad.Jobs().Info(jobID, &api.QueryOptions{Namespace: namespace})
+	if err != nil {
+		b.L.Warn("error reading job", "job_id", jobID, "namespace", namespace, "error", err)
+		return nil
+	}
+	b.jobs.put(namespace, job)
+	return job
+}
+
+// lookupJobVersion is lookupJob for one version of the job, it is only read from nomad
+// if that version is not cached yet. All events of a deployment are of the same version.
+func (b *Bot) lookupJobVersion(namespace, jobID string, version uint64) *api.Job {
+	if job := b.jobs.get(namespace, jobID, version); job != nil {
+		return job
+	}
+	job := b.lookupJob(namespace, jobID)
+	if job == nil || uint64Value(job.Version) == version {
+		return job
+	}
+
+	// the deployment is of an older version than the job, e.g. superseded by a newer one
+	if b.nomad == nil {
+		return nil
+	}
+	versions, _, _, err := b.nomad.Jobs().Versions(jobID, false, &api.QueryOptions{Namespace: namespace})
+	if err != nil {
+		b.L.Warn("error reading job versions", "job_id", jobID, "namespace", namespace, "error", err)
+		return nil
+	}
+	job = nil
+	for _, v := range versions {
+		b.jobs.put(namespace, v)
+		if uint64Value(v.Version) == version {
+			job = v
+		}
+	}
+	return job
+}
+
+func (b *Bot) UpsertAllocationMsg(alloc api.Allocation) error {
+	// only report the last alloc of a reschedule chain
+	if alloc.NextAllocation != "" {
+		return nil
+	}
+
+	findings := b.cfg.Classifier.Classify(alloc)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	n := allocationNotification(alloc, findings, b.nomadAddress)
+	n.TTL = b.cfg.AllocTTL
+	return b.send(n)
+}
+
+func (b *Bot) UpsertJobMsg(eventType string, job api.Job) error {
+	switch eventType {
+	case structs.TypeJobRegistered:
+		b.jobs.put(stringValue(job.Namespace), &job)
+	case structs.TypeJobDeregistered, structs.TypeJobBatchDeregistered:
+		b.jobs.delete(stringValue(job.Namespace), stringValue(job.ID))
+	}
+
+	changes, err := b.jobChanges(eventType, job)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return b.send(jobNotification(eventType, job, changes, b.nomadAddress))
+}
+
+func (b *Bot) UpsertNodeMsg(eventType string, node api.Node) error {
+	changes := b.nodes.changes(eventType, node)
+	if len(changes) == 0 {
+		return nil
+	}
+	b.L.Info("node changed", "node_id", node.ID, "node_name", node.Name, "changes", changes)
+
+	return b.send(nodeNotification(node, changes, b.nomadAddress))
+}
+
+// UpsertEvalMsg reports blocked evaluations or ones with placement failures,
+// once per job until it is placed again.
+func (b *Bot) UpsertEvalMsg(eventType string, eval api.Evaluation) error {
+	if b.evals.seen(eval) {
+		return nil
+	}
+	failures := placementFailures(eval)
+	b.L.Info("placement failure", "eval_id", eval.ID, "job_id", eval.JobID, "status", eval.Status, "failures", failures)
+
+	job := b.lookupJob(eval.Namespace, eval.JobID)
+	return b.send(evalNotification(eval, job, failures, b.nomadAddress))
+}
+
+func (b *Bot) UpsertServiceMsg(eventType string, service api.ServiceRegistration) error {
+	return b.send(serviceNotification(eventType, service, b.nomadAddress))
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func uint64Value(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+// fakeImpl records the messages posted and updated, posts block until release is closed.
+type fakeImpl struct {
+	name    string
+	release chan struct{}
+
+	mu      sync.Mutex
+	posts   int
+	updates []string
+}
+
+func (f *fakeImpl) Name() string { return f.name }
+func (f *fakeImpl) Type() string { return "fake" }
+
+func (f *fakeImpl) Post(n Notification) (string, error) {
+	<-f.release
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.posts++
+	return fmt.Sprintf("%s-%d", f.name, f.posts), nil
+}
+
+func (f *fakeImpl) Update(messageID string, n Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, messageID)
+	return nil
+}
+
+func newTestBot(t *testing.T, impls ...Impl) *Bot {
+	t.Helper()
+	templates, err := NewTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := make(map[string]Instance)
+	for _, impl := range impls {
+		instances[impl.Name()] = Instance{}
+	}
+	return &Bot{
+		bots:      impls,
+		instances: instances,
+		router:    &router{},
+		cfg:       Config{Store: store.NewMemory(nil), Templates: templates},
+		L:         slog.Default(),
+	}
+}
+
+func TestSendSameKeyPostsOnce(t *testing.T) {
+	f := &fakeImpl{name: "fake", release: make(chan struct{})}
+	b := newTestBot(t, f)
+
+	n := Notification{Kind: KindDeployment, Key: "d1", TTL: time.Hour}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.send(n); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	close(f.release)
+	wg.Wait()
+
+	if f.posts != 1 {
+		t.Errorf("posts = %d, want 1", f.posts)
+	}
+	if want := []string{"fake-1", "fake-1"}; fmt.Sprint(f.updates) != fmt.Sprint(want) {
+		t.Errorf("updates = %v, want %v", f.updates, want)
+	}
+	if len(b.keys) != 0 {
+		t.Errorf("%d key locks left", len(b.keys))
+	}
+}
+
+func TestSendOtherKeyNotBlocked(t *testing.T) {
+	f := &fakeImpl{name: "fake", release: make(chan struct{})}
+	b := newTestBot(t, f)
+
+	blocked := make(chan error)
+	go func() {
+		blocked <- b.send(Notification{Kind: KindDeployment, Key: "d1"})
+	}()
+
+	// the update of another key is sent while the post of d1 waits
+	key := store.Key{Backend: "fake", Kind: KindDeployment, ID: "d2"}
+	if err := b.cfg.Store.Set(key, "m2", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- b.send(Notification{Kind: KindDeployment, Key: "d2"})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send of another key blocked by a pending post")
+	}
+
+	close(f.release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	if f.posts != 1 || len(f.updates) != 1 || f.updates[0] != "m2" {
+		t.Errorf("posts = %d, updates = %v", f.posts, f.updates)
+	}
+}
+
+func TestUpsertAllocationMsgReplayed(t *testing.T) {
+	f := &fakeImpl{name: "fake", release: make(chan struct{})}
+	close(f.release)
+	b := newTestBot(t, f)
+	b.cfg.Classifier = classify.New()
+
+	// an OOM kill from before an outage, replayed from the checkpoint
+	alloc := api.Allocation{
+		ID: "a1", JobID: "web", Namespace: "default",
+		ModifyTime: time.Now().Add(-8 * time.Minute).UnixNano(),
+		TaskStates: map[string]*api.TaskState{"web": {Events: []*api.TaskEvent{
+			{Type: structs.TaskTerminated, DisplayMessage: "OOM Killed", Details: map[string]string{"oom_killed": "true"}},
+		}}},
+	}
+	if err := b.UpsertAllocationMsg(alloc); err != nil {
+		t.Fatal(err)
+	}
+	// rescheduled allocations are reported by their replacement
+	alloc.ID, alloc.NextAllocation = "a0", "a1"
+	if err := b.UpsertAllocationMsg(alloc); err != nil {
+		t.Fatal(err)
+	}
+	if f.posts != 1 {
+		t.Errorf("posts = %d, want 1", f.posts)
+	}
+}
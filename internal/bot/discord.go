@@ -1,249 +1,166 @@
 package bot
 
 import (
-	"bytes"
 	"fmt"
 	"log/slog"
 	"strings"
 	"sync"
-	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/go-resty/resty/v2"
-	"github.com/hashicorp/nomad/api"
-	"github.com/hashicorp/nomad/nomad/structs"
-	"github.com/ttys3/nomad-event-notifier/version"
 )
 
-func NewDiscordBot(cfg Config, nomadAddress string) (Impl, error) {
-	if cfg.WebhookURL == "" {
+// limits of discord embeds
+// ref https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+const (
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+	discordFieldLimit       = 1024
+	discordFieldCountLimit  = 25
+	discordFooterLimit      = 2048
+)
+
+func NewDiscordBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Discord) == 0 {
 		return nil, fmt.Errorf("please set discord webhook url to enable discord bot: %w", errImplNotEnabled)
 	}
 
-	bot := &discordBot{
-		deploys:      make(map[string]string),
-		nomadAddress: nomadAddress,
-		allocations:  make(map[string]string),
-		client:       resty.New(),
-		webhookURL:   cfg.WebhookURL,
-		L:            slog.With("bot", "discord"),
+	var bots []Impl
+	for _, c := range cfg.Discord {
+		if c.WebhookURL == "" {
+			return nil, fmt.Errorf("discord %q: webhook url is required", c.Name)
+		}
+		bots = append(bots, &discordBot{
+			name:       c.Name,
+			client:     resty.New(),
+			webhookURL: c.WebhookURL,
+			L:          slog.With("bot", "discord", "instance", c.Name),
+		})
 	}
 
-	return bot, nil
+	return bots, nil
 }
 
 type discordBot struct {
-	mu           sync.Mutex
-	nomadAddress string
-	webhookURL   string
-	client       *resty.Client
-	deploys      map[string]string
-	allocations  map[string]string
-	L            *slog.Logger
+	mu         sync.Mutex
+	name       string
+	webhookURL string
+	client     *resty.Client
+	L          *slog.Logger
 }
 
-func (b *discordBot) UpsertDeployMsg(deploy api.Deployment) error {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	b.L.Info("begin UpsertDeployMsg", "deploy", deploy)
-	messageID, ok := b.deploys[deploy.ID]
-	if !ok || messageID == "" {
-		b.L.Debug("no existing deployment found, creating new message")
-		return b.initialDeployMsg(deploy)
-	}
-	b.L.Debug("existing deployment found, updating status", "discord_message_id", messageID)
-
-	attachments := b.DefaultAttachmentsDeployment(deploy)
-
-	var r discordgo.Message
-	rsp, err := b.client.R().SetBody(attachments).SetResult(&r).Patch(b.webhookURL + "/messages/" + messageID)
-	if err != nil {
-		return fmt.Errorf("failed to update previous message, id=%v, err=%w", messageID, err)
-	}
-	if rsp.StatusCode() >= 300 {
-		return fmt.Errorf("failed to update previous message, %s, code=%v", rsp.Body(), rsp.StatusCode())
-	}
-	b.L.Debug("updated deployment message", "discord_message_id", r.ID, "deploy_id", deploy.ID,
-		"discord_message", r, "response", string(rsp.Body()))
-	b.deploys[deploy.ID] = r.ID
-
-	return nil
+func (b *discordBot) Name() string {
+	return b.name
 }
 
-func (b *discordBot) initialDeployMsg(deploy api.Deployment) error {
-	b.L.Info("init deploy message")
+func (b *discordBot) Type() string {
+	return "discord"
+}
 
-	attachments := b.DefaultAttachmentsDeployment(deploy)
+func (b *discordBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	_, err := b.client.R().SetBody(attachments).Post(b.webhookURL)
+	msg := b.message(n)
 
 	var r discordgo.Message
 	// ref https://discord.com/developers/docs/resources/webhook#execute-webhook
-	res, err := b.client.R().SetBody(attachments).SetResult(&r).SetQueryString("wait=true").Post(b.webhookURL)
+	res, err := b.client.R().SetBody(msg).SetResult(&r).SetQueryString("wait=true").Post(b.webhookURL)
 	if err != nil {
-		return fmt.Errorf("failed to post,err=%w, body=%v", err, attachments)
+		return "", fmt.Errorf("failed to post,err=%w, body=%v", err, msg)
 	}
 	if res.StatusCode() >= 300 {
-		b.L.Error("failed to create message %s, code=%v", string(res.Body()), res.StatusCode())
-		return fmt.Errorf("failed to create message %s, code=%v", res.Body(), res.StatusCode())
+		return "", fmt.Errorf("failed to create message %s, code=%v", res.Body(), res.StatusCode())
 	}
-	b.L.Debug("created deployment message success", "discord_message_id", r.ID, "deploy_id", deploy.ID,
-		"discord_message", r, "response", string(res.Body()))
+	b.L.Debug("created message success", "discord_message_id", r.ID, "kind", n.Kind, "key", n.Key,
+		"response", string(res.Body()))
 
-	b.deploys[deploy.ID] = r.ID
-	return nil
+	return r.ID, nil
 }
 
-func (b *discordBot) UpsertAllocationMsg(alloc api.Allocation) error {
-	// do not report old OOM
-	if time.Now().Unix()-alloc.ModifyTime > 300 {
-		return nil
-	}
-	// only report last alloc OOM
-	if alloc.NextAllocation != "" {
-		return nil
-	}
+func (b *discordBot) Update(messageID string, n Notification) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.L.Info("begin UpsertAllocationMsg", "alloc", alloc)
-
-	messageID, ok := b.allocations[alloc.ID]
-	if !ok || messageID == "" {
-		b.L.Debug("no existing allocation found, creating new message")
-		return b.initialAllocMsg(alloc)
-	}
-	b.L.Debug("Existing allocation found, updating status", "discord_message_id", messageID)
-
-	attachments := b.defaultAttachmentsAlloc(alloc)
-	if len(attachments.Embeds) == 0 {
-		return nil
-	}
+	msg := b.message(n)
 
 	// https://discord.com/developers/docs/resources/webhook#edit-webhook-message
 	// Starting with API v10, the attachments array must contain all attachments that should be present after edit,
 	// including retained and new attachments provided in the request body.
 	var r discordgo.Message
-	res, err := b.client.R().SetBody(attachments).SetResult(&r).Patch(b.webhookURL + "/messages/" + messageID)
+	res, err := b.client.R().SetBody(msg).SetResult(&r).Patch(b.webhookURL + "/messages/" + messageID)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to update previous message, id=%v, err=%w", messageID, err)
 	}
 	if res.StatusCode() >= 300 {
-		return fmt.Errorf("failed to update previous message, %s", res.Body())
+		return fmt.Errorf("failed to update previous message, %s, code=%v", res.Body(), res.StatusCode())
 	}
-	b.allocations[alloc.ID] = r.ID
+	b.L.Debug("updated message", "discord_message_id", r.ID, "kind", n.Kind, "key", n.Key,
+		"response", string(res.Body()))
 
 	return nil
 }
 
-func (b *discordBot) initialAllocMsg(alloc api.Allocation) error {
-	attachments := b.defaultAttachmentsAlloc(alloc)
-	if len(attachments.Embeds) == 0 {
-		return nil
+func (b *discordBot) message(n Notification) discordgo.MessageSend {
+	var description []string
+	if n.Summary != "" {
+		description = append(description, n.Summary)
 	}
-
-	var r discordgo.Message
-	response, err := b.client.R().SetBody(attachments).SetResult(&r).SetQueryString("wait=true").Post(b.webhookURL)
-	if err != nil {
-		return fmt.Errorf("post message failed,  err=%w", err)
+	for _, l := range n.Links {
+		description = append(description, fmt.Sprintf("[%s](%s)", l.Title, l.URL))
 	}
-	b.L.Debug("created allocation message success", "discord_message_id", r.ID, "alloc_id", alloc.ID,
-		"discord_message", r, "response", string(response.Body()))
-	b.deploys[alloc.ID] = r.ID
-	return nil
-}
-
-func (b *discordBot) DefaultAttachmentsDeployment(deploy api.Deployment) discordgo.MessageSend {
-	var content = bytes.NewBufferString("nomad deploy\n")
-	content.WriteString(deploy.StatusDescription)
-	content.WriteString("\n")
 
-	var msg = discordgo.MessageSend{}
-
-	var fields []*discordgo.MessageEmbed
-
-	for tgn, tg := range deploy.TaskGroups {
-		field := &discordgo.MessageEmbed{
-			Color: discordColorForStatus(deploy.Status),
-			Title: fmt.Sprintf("Task Group: %s", tgn),
-			Description: fmt.Sprintf("Desired: %d, Placed: %d, Healthy: %d, Unhealthy: %d, DesiredCanaries: %d, PlacedCanaries: %+v",
-				tg.DesiredTotal, tg.PlacedAllocs, tg.HealthyAllocs, tg.UnhealthyAllocs, tg.DesiredCanaries, tg.PlacedCanaries),
+	var fields []*discordgo.MessageEmbedField
+	for _, f := range n.Fields {
+		if len(fields) == discordFieldCountLimit {
+			break
 		}
-		fields = append(fields, field)
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   truncate(f.Title, discordTitleLimit),
+			Value:  truncate(f.Value, discordFieldLimit),
+			Inline: f.Short,
+		})
 	}
-	msg.Embeds = fields
-
-	fmt.Fprintf(content, "%s deployment update\n", deploy.JobID)
-	fmt.Fprintf(content, "url: %s/ui/jobs/%s/deployments\n", b.nomadAddress, deploy.JobID)
-	fmt.Fprintf(content, "Deploy ID: %s\n", deploy.ID)
-	fmt.Fprintf(content, "nomad-event-notifier: %s\n", version.Version)
 
-	msg.Content = content.String()
-	return msg
-}
-
-func (b *discordBot) defaultAttachmentsAlloc(alloc api.Allocation) discordgo.MessageSend {
-	var fields []*discordgo.MessageEmbed
-	for taskName, taskState := range alloc.TaskStates {
-		field := discordgo.MessageEmbed{
-			Title: fmt.Sprintf("taskState:%s Failed: %v, Restarts: %d Task Group: %s Task: %s",
-				taskState.State, taskState.Failed, taskState.Restarts, alloc.TaskGroup, taskName),
-			Color: discordColorForStatus(alloc.ClientStatus),
-		}
-		gotOOM := false
-		value := "---------------------------------------------\n"
-		for _, event := range taskState.Events {
-			if strings.Contains(event.DisplayMessage, "OOM") {
-				gotOOM = true
-			}
-
-			value += fmt.Sprintf("*%s*: %s %s", event.Type, event.DisplayMessage, event.Details["driver_message"])
-			if event.Type == structs.TaskTerminated {
-				for _, key := range []string{"exit_code", "signal"} {
-					if val, ok := event.Details[key]; ok && val != "" {
-						value += fmt.Sprintf(", %s: %s", key, val)
-					}
-				}
-			}
-			if event.Type == structs.TaskKilled {
-				for _, key := range []string{"kill_reason", "kill_error", "kill_timeout"} {
-					if val, ok := event.Details[key]; ok && val != "" {
-						value += fmt.Sprintf(", %s: %s", key, val)
-					}
-				}
-			}
-			value += "\n"
-		}
-		field.Description = value
-		if !gotOOM {
-			continue
-		}
-		fields = append(fields, &field)
+	embed := &discordgo.MessageEmbed{
+		Title:       truncate(n.Title, discordTitleLimit),
+		URL:         n.URL,
+		Description: truncate(strings.Join(description, "\n"), discordDescriptionLimit),
+		Color:       discordColorForSeverity(n.Severity),
+		Fields:      fields,
 	}
-
-	if len(fields) == 0 {
-		return discordgo.MessageSend{}
+	if n.Footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: truncate(n.Footer, discordFooterLimit)}
 	}
 
-	var content = bytes.NewBufferString("nomad alloc\n")
-	fmt.Fprintf(content, "Allocation ID: %s\n%s allocation update\nurl: %s/ui/jobs/%s/%s\n", alloc.ID, alloc.ID, b.nomadAddress, alloc.JobID, alloc.TaskGroup)
-	fmt.Fprintf(content, "nomad-event-notifier: %s\n", version.Version)
-
 	return discordgo.MessageSend{
-		Content: content.String(),
-		Embeds:  fields,
+		Embeds: []*discordgo.MessageEmbed{embed},
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n-3]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
 	}
+	return s + "..."
 }
 
-func discordColorForStatus(status string) int {
-	switch status {
-	case "failed":
+func discordColorForSeverity(severity Severity) int {
+	switch severity {
+	case SeverityError:
 		return 14503512 // "#dd4e58"
-	case "running":
+	case SeverityInfo:
 		return 1945343 // "#1daeff"
-	case "successful":
+	case SeveritySuccess:
 		return 3581519 // "#36a64f"
+	case SeverityWarning:
+		return 15910724 // "#f2c744"
 	default:
 		return 13882323 // "#D3D3D3"
 	}
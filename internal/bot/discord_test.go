@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"0123456789abc", 10, "0123456..."},
+		// "é" is two bytes, cutting at 7 bytes would split the fourth one
+		{"éééééé", 10, "ééé..."},
+		{"日本語のテキスト", 10, "日本..."},
+	}
+	for _, c := range cases {
+		got := truncate(c.s, c.n)
+		if got != c.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", c.s, c.n, got, c.want)
+		}
+		if len(got) > c.n || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q is longer than the limit or invalid UTF-8", c.s, c.n, got)
+		}
+	}
+}
+
+func TestDiscordMessageLimits(t *testing.T) {
+	n := Notification{
+		Title:   strings.Repeat("t", 300),
+		Summary: "summary",
+		Links:   []Link{{Title: "logs", URL: "https://logs"}},
+	}
+	for i := 0; i < 30; i++ {
+		n.Fields = append(n.Fields, Field{Title: fmt.Sprintf("field %d", i), Value: strings.Repeat("ü", 600)})
+	}
+
+	embed := (&discordBot{}).message(n).Embeds[0]
+	if len(embed.Title) != discordTitleLimit {
+		t.Errorf("title is %d bytes, want %d", len(embed.Title), discordTitleLimit)
+	}
+	if len(embed.Fields) != discordFieldCountLimit {
+		t.Errorf("%d fields, want %d", len(embed.Fields), discordFieldCountLimit)
+	}
+	for _, f := range embed.Fields {
+		if len(f.Value) > discordFieldLimit || !utf8.ValidString(f.Value) {
+			t.Errorf("field %s value is %d bytes or invalid UTF-8", f.Name, len(f.Value))
+		}
+	}
+	if want := "summary\n[logs](https://logs)"; embed.Description != want {
+		t.Errorf("description = %q, want %q", embed.Description, want)
+	}
+
+	n.Summary = strings.Repeat("ö", 3000)
+	n.Footer = strings.Repeat("ä", 1500)
+	embed = (&discordBot{}).message(n).Embeds[0]
+	if len(embed.Description) > discordDescriptionLimit || !utf8.ValidString(embed.Description) {
+		t.Errorf("description is %d bytes or invalid UTF-8", len(embed.Description))
+	}
+	if len(embed.Footer.Text) > discordFooterLimit || !utf8.ValidString(embed.Footer.Text) {
+		t.Errorf("footer is %d bytes or invalid UTF-8", len(embed.Footer.Text))
+	}
+}
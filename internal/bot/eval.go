@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// PlacementFailure explains why the allocations of one task group could not be placed.
+type PlacementFailure struct {
+	TaskGroup string
+	Details   []string
+}
+
+// placementFailures renders the allocation metrics of an evaluation's failed task groups,
+// sorted by task group name so the result can be compared between evaluations.
+func placementFailures(eval api.Evaluation) []PlacementFailure {
+	var failures []PlacementFailure
+	for _, tg := range sortedKeys(eval.FailedTGAllocs) {
+		failures = append(failures, PlacementFailure{
+			TaskGroup: tg,
+			Details:   allocationMetricDetails(eval.FailedTGAllocs[tg]),
+		})
+	}
+	return failures
+}
+
+func allocationMetricDetails(m *api.AllocationMetric) []string {
+	if m == nil {
+		return nil
+	}
+
+	details := []string{
+		fmt.Sprintf("Nodes evaluated: %d, filtered: %d, exhausted: %d, in pool: %d",
+			m.NodesEvaluated, m.NodesFiltered, m.NodesExhausted, m.NodesInPool),
+	}
+	if m.CoalescedFailures > 0 {
+		details = append(details, fmt.Sprintf("%d more allocations failed to place", m.CoalescedFailures))
+	}
+	if len(m.NodesAvailable) > 0 {
+		details = append(details, "Nodes available: "+formatCounts(m.NodesAvailable))
+	}
+	for _, item := range []struct {
+		title  string
+		counts map[string]int
+	}{
+		{"Class filtered", m.ClassFiltered},
+		{"Constraint filtered", m.ConstraintFiltered},
+		{"Class exhausted", m.ClassExhausted},
+		{"Dimension exhausted", m.DimensionExhausted},
+	} {
+		if len(item.counts) > 0 {
+			details = append(details, fmt.Sprintf("%s: %s", item.title, formatCounts(item.counts)))
+		}
+	}
+	if len(m.QuotaExhausted) > 0 {
+		details = append(details, "Quota exhausted: "+strings.Join(m.QuotaExhausted, ", "))
+	}
+	return details
+}
+
+// formatCounts renders a count map as "a (1), b (2)" sorted by key.
+func formatCounts(counts map[string]int) string {
+	var parts []string
+	for _, k := range sortedKeys(counts) {
+		parts = append(parts, fmt.Sprintf("%s (%d)", k, counts[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// failureSignature identifies the reasons placements failed, leaving out the node counts
+// which change on every retry.
+func failureSignature(eval api.Evaluation) string {
+	if len(eval.FailedTGAllocs) == 0 {
+		return eval.Status
+	}
+
+	var b strings.Builder
+	for _, tg := range sortedKeys(eval.FailedTGAllocs) {
+		m := eval.FailedTGAllocs[tg]
+		b.WriteString(tg)
+		if m == nil {
+			continue
+		}
+		for _, counts := range []map[string]int{m.ClassFiltered, m.ConstraintFiltered, m.ClassExhausted, m.DimensionExhausted} {
+			b.WriteString("|" + strings.Join(sortedKeys(counts), ","))
+		}
+		b.WriteString("|" + strings.Join(m.QuotaExhausted, ","))
+		b.WriteString(";")
+	}
+	return b.String()
+}
+
+// evalDedupeTTL is how long a reported placement failure is remembered,
+// a job still failing to place after that is reported again.
+const evalDedupeTTL = 24 * time.Hour
+
+type evalReport struct {
+	signature  string
+	reportedAt time.Time
+}
+
+// evalDeduper remembers the last placement failure reported per job,
+// so the evaluations nomad keeps retrying for a blocked job are only reported once.
+// Reports are forgotten after ttl, so jobs that are stopped while blocked do not pile up.
+type evalDeduper struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	last      map[string]evalReport
+	lastSweep time.Time
+}
+
+func newEvalDeduper(ttl time.Duration) *evalDeduper {
+	return &evalDeduper{ttl: ttl, last: make(map[string]evalReport), lastSweep: time.Now()}
+}
+
+// seen records the placement failures of eval and returns true if they were already reported for its job.
+// A successful evaluation clears the job, so the next failure is reported again.
+func (d *evalDeduper) seen(eval api.Evaluation) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep()
+	job := eval.Namespace + "/" + eval.JobID
+	if len(eval.FailedTGAllocs) == 0 && eval.Status != api.EvalStatusBlocked {
+		if eval.Status == api.EvalStatusComplete {
+			delete(d.last, job)
+		}
+		return true
+	}
+
+	signature := failureSignature(eval)
+	if last, ok := d.last[job]; ok && last.signature == signature && time.Since(last.reportedAt) < d.ttl {
+		return true
+	}
+	d.last[job] = evalReport{signature: signature, reportedAt: time.Now()}
+	return false
+}
+
+// sweep drops the expired reports, at most once per ttl. It must be called with mu held.
+func (d *evalDeduper) sweep() {
+	if time.Since(d.lastSweep) < d.ttl {
+		return
+	}
+	for job, last := range d.last {
+		if time.Since(last.reportedAt) >= d.ttl {
+			delete(d.last, job)
+		}
+	}
+	d.lastSweep = time.Now()
+}
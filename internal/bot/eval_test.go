@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func blockedEval(dimension string, nodesEvaluated int) api.Evaluation {
+	return api.Evaluation{
+		Namespace: "default",
+		JobID:     "web",
+		Status:    api.EvalStatusBlocked,
+		FailedTGAllocs: map[string]*api.AllocationMetric{
+			"web": {NodesEvaluated: nodesEvaluated, DimensionExhausted: map[string]int{dimension: nodesEvaluated}},
+		},
+	}
+}
+
+func TestEvalDeduper(t *testing.T) {
+	d := newEvalDeduper(time.Hour)
+	complete := api.Evaluation{Namespace: "default", JobID: "web", Status: api.EvalStatusComplete}
+
+	steps := []struct {
+		name string
+		eval api.Evaluation
+		seen bool
+	}{
+		{"first failure", blockedEval("memory", 3), false},
+		{"retry with other node counts", blockedEval("memory", 5), true},
+		{"other reason", blockedEval("cpu", 5), false},
+		{"other job", func() api.Evaluation { e := blockedEval("cpu", 5); e.JobID = "api"; return e }(), false},
+		{"placed", complete, true},
+		{"failing again", blockedEval("cpu", 5), false},
+	}
+	for _, step := range steps {
+		if got := d.seen(step.eval); got != step.seen {
+			t.Errorf("%s: seen() = %v, want %v", step.name, got, step.seen)
+		}
+	}
+}
+
+func TestEvalDeduperExpires(t *testing.T) {
+	d := newEvalDeduper(20 * time.Millisecond)
+	if d.seen(blockedEval("memory", 3)) {
+		t.Fatal("first failure seen")
+	}
+	if !d.seen(blockedEval("memory", 3)) {
+		t.Fatal("retry not seen")
+	}
+
+	other := blockedEval("memory", 3)
+	other.JobID = "api"
+	time.Sleep(30 * time.Millisecond)
+	if d.seen(other) {
+		t.Fatal("failure of other job seen")
+	}
+	if len(d.last) != 1 {
+		t.Errorf("%d jobs remembered, want the expired one swept", len(d.last))
+	}
+	if d.seen(blockedEval("memory", 3)) {
+		t.Error("failure still seen after ttl")
+	}
+}
+
+func TestAllocationMetricDetails(t *testing.T) {
+	m := &api.AllocationMetric{
+		NodesEvaluated:     3,
+		NodesExhausted:     2,
+		NodesInPool:        3,
+		CoalescedFailures:  1,
+		ConstraintFiltered: map[string]int{"${attr.kernel.name} = linux": 1},
+		DimensionExhausted: map[string]int{"memory": 1, "cpu": 1},
+	}
+	want := []string{
+		"Nodes evaluated: 3, filtered: 0, exhausted: 2, in pool: 3",
+		"1 more allocations failed to place",
+		"Constraint filtered: ${attr.kernel.name} = linux (1)",
+		"Dimension exhausted: cpu (1), memory (1)",
+	}
+	got := allocationMetricDetails(m)
+	if len(got) != len(want) {
+		t.Fatalf("allocationMetricDetails() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
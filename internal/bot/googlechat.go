@@ -0,0 +1,192 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// google chat messages are cardsV2 posted to an incoming webhook, the messages about one deployment
+// are replies in the thread of its deployment ID.
+// ref https://developers.google.com/workspace/chat/quickstart/webhooks
+// ref https://developers.google.com/workspace/chat/api/reference/rest/v1/cards
+
+type googleChatMessage struct {
+	CardsV2 []googleChatCard `json:"cardsV2"`
+}
+
+type googleChatCard struct {
+	CardID string         `json:"cardId"`
+	Card   googleChatBody `json:"card"`
+}
+
+type googleChatBody struct {
+	Header   googleChatHeader    `json:"header"`
+	Sections []googleChatSection `json:"sections,omitempty"`
+}
+
+type googleChatHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type googleChatSection struct {
+	Widgets []googleChatWidget `json:"widgets"`
+}
+
+// googleChatWidget sets exactly one of its fields.
+type googleChatWidget struct {
+	DecoratedText *googleChatDecoratedText `json:"decoratedText,omitempty"`
+	TextParagraph *googleChatText          `json:"textParagraph,omitempty"`
+	ButtonList    *googleChatButtonList    `json:"buttonList,omitempty"`
+}
+
+type googleChatDecoratedText struct {
+	TopLabel string `json:"topLabel,omitempty"`
+	Text     string `json:"text"`
+	WrapText bool   `json:"wrapText"`
+}
+
+type googleChatText struct {
+	Text string `json:"text"`
+}
+
+type googleChatButtonList struct {
+	Buttons []googleChatButton `json:"buttons"`
+}
+
+type googleChatButton struct {
+	Text    string            `json:"text"`
+	OnClick googleChatOnClick `json:"onClick"`
+}
+
+type googleChatOnClick struct {
+	OpenLink googleChatLink `json:"openLink"`
+}
+
+type googleChatLink struct {
+	URL string `json:"url"`
+}
+
+func newGoogleChatBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.GoogleChat) == 0 {
+		return nil, fmt.Errorf("please set google chat webhook url to enable google chat bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.GoogleChat {
+		if c.WebhookURL == "" {
+			return nil, fmt.Errorf("google chat %q: webhook url is required", c.Name)
+		}
+		bots = append(bots, &googleChatBot{
+			name:       c.Name,
+			client:     resty.New(),
+			webhookURL: c.WebhookURL,
+			posted:     postedStatus{backend: c.Name, store: cfg.Store},
+			L:          slog.With("bot", "google_chat", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+// googleChatBot can not edit messages, webhooks may only create them.
+// Updates are replies in the thread of the deployment instead, only when its status changes.
+type googleChatBot struct {
+	mu         sync.Mutex
+	name       string
+	webhookURL string
+	client     *resty.Client
+	posted     postedStatus
+	L          *slog.Logger
+}
+
+func (b *googleChatBot) Name() string {
+	return b.name
+}
+
+func (b *googleChatBot) Type() string {
+	return "google_chat"
+}
+
+func (b *googleChatBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	unchanged, err := b.posted.unchanged(n)
+	if err != nil {
+		return "", err
+	}
+	if unchanged {
+		b.L.Debug("deployment status unchanged, skipping", "key", n.Key)
+		return "", nil
+	}
+
+	req := b.client.R().SetBody(b.message(n))
+	// the first message with a thread key starts the thread, later ones reply to it
+	threadKey := deploymentIDOf(n)
+	if threadKey != "" {
+		req.SetQueryParams(map[string]string{
+			"threadKey":          threadKey,
+			"messageReplyOption": "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD",
+		})
+	}
+
+	res, err := req.Post(b.webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to post, err=%w", err)
+	}
+	if res.StatusCode() >= 300 {
+		return "", fmt.Errorf("failed to create message %s, code=%v", res.Body(), res.StatusCode())
+	}
+	b.L.Debug("created message success", "kind", n.Kind, "key", n.Key, "thread_key", threadKey)
+
+	return "", b.posted.save(n)
+}
+
+// message renders n as a card, texts of cards support a subset of HTML so all values are escaped.
+func (b *googleChatBot) message(n Notification) googleChatMessage {
+	var widgets []googleChatWidget
+	if n.Summary != "" {
+		widgets = append(widgets, googleChatWidget{TextParagraph: &googleChatText{
+			Text: fmt.Sprintf(`<font color="%s"><b>%s</b></font>`, slackColorForSeverity(n.Severity), html.EscapeString(n.Summary)),
+		}})
+	}
+	for _, f := range n.Fields {
+		value := html.EscapeString(strings.TrimSpace(f.Value))
+		widgets = append(widgets, googleChatWidget{DecoratedText: &googleChatDecoratedText{
+			TopLabel: f.Title,
+			Text:     strings.ReplaceAll(value, "\n", "<br>"),
+			WrapText: true,
+		}})
+	}
+	if n.Footer != "" {
+		widgets = append(widgets, googleChatWidget{TextParagraph: &googleChatText{
+			Text: `<font color="#808080">` + html.EscapeString(n.Footer) + "</font>",
+		}})
+	}
+
+	var buttons []googleChatButton
+	if n.URL != "" {
+		buttons = append(buttons, googleChatButton{Text: "Open in Nomad", OnClick: googleChatOnClick{OpenLink: googleChatLink{URL: n.URL}}})
+	}
+	for _, l := range n.Links {
+		buttons = append(buttons, googleChatButton{Text: l.Title, OnClick: googleChatOnClick{OpenLink: googleChatLink{URL: l.URL}}})
+	}
+	if len(buttons) > 0 {
+		widgets = append(widgets, googleChatWidget{ButtonList: &googleChatButtonList{Buttons: buttons}})
+	}
+
+	card := googleChatBody{Header: googleChatHeader{Title: n.Title, Subtitle: n.Subject.Namespace}}
+	if len(widgets) > 0 {
+		card.Sections = []googleChatSection{{Widgets: widgets}}
+	}
+
+	return googleChatMessage{
+		CardsV2: []googleChatCard{{CardID: n.Kind, Card: card}},
+	}
+}
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+func TestGoogleChatThreads(t *testing.T) {
+	type request struct {
+		threadKey, replyOption string
+		msg                    googleChatMessage
+	}
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg googleChatMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		requests = append(requests, request{
+			threadKey:   r.URL.Query().Get("threadKey"),
+			replyOption: r.URL.Query().Get("messageReplyOption"),
+			msg:         msg,
+		})
+		// the key and token of the webhook are kept
+		if r.URL.Query().Get("key") != "k" {
+			t.Errorf("webhook key lost: %s", r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	impls, err := newGoogleChatBot(Config{GoogleChat: []GoogleChatConfig{{
+		Instance: Instance{Name: "chat"}, WebhookURL: srv.URL + "/v1/spaces/s/messages?key=k&token=t",
+	}}, Store: store.NewMemory(nil)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deploy := jobDeployment("d1", "failed")
+	deploy.Summary = "a <b> & c"
+	for _, n := range []Notification{deploy, oomAllocation("a1"), {Kind: KindNode, Title: "node drained"}} {
+		if _, err := impls[0].Post(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("%d requests, want 3", len(requests))
+	}
+	if requests[0].threadKey != "d1" || requests[0].replyOption != "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD" {
+		t.Errorf("deployment thread = %q, %q", requests[0].threadKey, requests[0].replyOption)
+	}
+	// allocations not placed by a deployment start no thread
+	if requests[1].threadKey != "" || requests[2].threadKey != "" {
+		t.Errorf("thread keys = %q, %q, want none", requests[1].threadKey, requests[2].threadKey)
+	}
+
+	card := requests[0].msg.CardsV2[0]
+	if card.CardID != KindDeployment || card.Card.Header.Title != "web deployment failed" || card.Card.Header.Subtitle != "prod" {
+		t.Errorf("card = %+v", card)
+	}
+	summary := card.Card.Sections[0].Widgets[0].TextParagraph
+	if summary == nil || summary.Text != `<font color="#dd4e58"><b>a &lt;b&gt; &amp; c</b></font>` {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestGoogleChatPostsStatusChanges(t *testing.T) {
+	var titles []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg googleChatMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		titles = append(titles, msg.CardsV2[0].Card.Header.Title)
+	}))
+	defer srv.Close()
+
+	impls, err := newGoogleChatBot(Config{
+		GoogleChat: []GoogleChatConfig{{Instance: Instance{Name: "chat"}, WebhookURL: srv.URL}},
+		Store:      store.NewMemory(nil),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := []api.Deployment{
+		{Status: "running", StatusDescription: "Deployment is running"},
+		{Status: "running", StatusDescription: "Deployment is running", TaskGroups: map[string]*api.DeploymentState{"web": {PlacedAllocs: 1}}},
+		{Status: "running", StatusDescription: "Deployment is running", TaskGroups: map[string]*api.DeploymentState{"web": {PlacedAllocs: 2}}},
+		{Status: "failed", StatusDescription: "Failed due to unhealthy allocations"},
+		{Status: "failed", StatusDescription: "Failed due to unhealthy allocations"},
+	}
+	for _, deploy := range updates {
+		deploy.ID = "d1"
+		deploy.JobID = "web"
+		n := deploymentNotification(deploy, nil, "http://nomad:4646")
+		n.Title = deploy.Status
+		n.TTL = time.Hour
+		if _, err := impls[0].Post(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// allocations of the deployment are always posted to its thread
+	for i := 0; i < 2; i++ {
+		if _, err := impls[0].Post(oomAllocation("a1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "running failed a1 allocation update a1 allocation update"
+	if got := strings.Join(titles, " "); got != want {
+		t.Errorf("posted %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+const (
+	// kindIncident keys the alerts opened for a job, they are closed by its next successful deployment
+	kindIncident = "incident"
+	// incidentTTL bounds how long a job waits for a successful deployment closing its alerts
+	incidentTTL = 30 * 24 * time.Hour
+)
+
+// incidents tracks the open alerts of each job for the alerting backends, by the ID the backend knows them.
+type incidents struct {
+	backend string
+	store   store.MessageStore
+}
+
+func (i incidents) key(s Subject) store.Key {
+	return store.Key{Backend: i.backend, Kind: kindIncident, ID: s.Namespace + "/" + s.JobID}
+}
+
+// open returns the IDs of the open alerts of the job of s.
+func (i incidents) open(s Subject) ([]string, error) {
+	key := i.key(s)
+	v, found, err := i.store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read open alerts of %s: %w", key.ID, err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return strings.Fields(v), nil
+}
+
+// add records the alert id as open for the job of s.
+func (i incidents) add(s Subject, id string) error {
+	ids, err := i.open(s)
+	if err != nil {
+		return err
+	}
+	for _, open := range ids {
+		if open == id {
+			return nil
+		}
+	}
+	return i.set(s, append(ids, id))
+}
+
+// set replaces the open alerts of the job of s, none removes the job.
+func (i incidents) set(s Subject, ids []string) error {
+	key := i.key(s)
+	if len(ids) == 0 {
+		return i.store.Delete(key)
+	}
+	if err := i.store.Set(key, strings.Join(ids, " "), incidentTTL); err != nil {
+		return fmt.Errorf("failed to save open alerts of %s: %w", key.ID, err)
+	}
+	return nil
+}
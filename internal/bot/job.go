@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// maxJobChangeLines bounds the diff summary, big changes link to the versions page anyway.
+const maxJobChangeLines = 20
+
+type fieldChange struct {
+	scope string
+	path  string
+	diff  *api.FieldDiff
+}
+
+// priority sorts the changes people care most about first.
+func (c fieldChange) priority() int {
+	switch {
+	case c.path == "Count", strings.HasSuffix(c.path, ".image"):
+		return 0
+	case strings.HasPrefix(c.path, "Resources."):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (c fieldChange) String() string {
+	name := c.path
+	if c.scope != "" {
+		name = c.scope + " " + c.path
+	}
+	switch c.diff.Type {
+	case "Added":
+		return fmt.Sprintf("+ %s: %s", name, c.diff.New)
+	case "Deleted":
+		return fmt.Sprintf("- %s: %s", name, c.diff.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s → %s", name, c.diff.Old, c.diff.New)
+	}
+}
+
+func flattenDiff(scope, prefix string, fields []*api.FieldDiff, objects []*api.ObjectDiff) []fieldChange {
+	var changes []fieldChange
+	for _, f := range fields {
+		if f.Type == "None" {
+			continue
+		}
+		changes = append(changes, fieldChange{scope: scope, path: prefix + f.Name, diff: f})
+	}
+	for _, o := range objects {
+		if o.Type == "None" {
+			continue
+		}
+		changes = append(changes, flattenDiff(scope, prefix+o.Name+".", o.Fields, o.Objects)...)
+	}
+	return changes
+}
+
+func diffSymbol(diffType string) string {
+	switch diffType {
+	case "Added":
+		return "+"
+	case "Deleted":
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// summarizeJobDiff renders a job diff as one line per change:
+// added and removed task groups and tasks, then counts, images and resources, then the rest.
+func summarizeJobDiff(diff *api.JobDiff) []string {
+	var lines []string
+	changes := flattenDiff("", "", diff.Fields, diff.Objects)
+
+	for _, tg := range diff.TaskGroups {
+		switch tg.Type {
+		case "None":
+			continue
+		case "Added", "Deleted":
+			lines = append(lines, fmt.Sprintf("%s group %s", diffSymbol(tg.Type), tg.Name))
+			continue
+		}
+
+		changes = append(changes, flattenDiff(tg.Name, "", tg.Fields, tg.Objects)...)
+		for _, task := range tg.Tasks {
+			scope := tg.Name + "/" + task.Name
+			switch task.Type {
+			case "None":
+			case "Added", "Deleted":
+				lines = append(lines, fmt.Sprintf("%s task %s", diffSymbol(task.Type), scope))
+			default:
+				changes = append(changes, flattenDiff(scope, "", task.Fields, task.Objects)...)
+			}
+		}
+	}
+
+	slices.SortStableFunc(changes, func(a, b fieldChange) int {
+		return cmp.Compare(a.priority(), b.priority())
+	})
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+
+	if len(lines) > maxJobChangeLines {
+		more := len(lines) - maxJobChangeLines
+		lines = append(lines[:maxJobChangeLines], fmt.Sprintf("... and %d more changes", more))
+	}
+	return lines
+}
+
+// jobChanges describes what a job event changed, nil if nothing worth a message.
+// For registrations the diff to the previous version is fetched from nomad.
+func (b *Bot) jobChanges(eventType string, job api.Job) ([]string, error) {
+	switch eventType {
+	case structs.TypeJobDeregistered, structs.TypeJobBatchDeregistered:
+		if job.Stop != nil && *job.Stop {
+			return []string{"stopped"}, nil
+		}
+		return []string{"deregistered"}, nil
+	case structs.TypeJobRegistered:
+	default:
+		return nil, nil
+	}
+
+	version := uint64Value(job.Version)
+	if version == 0 {
+		return []string{"new job registered"}, nil
+	}
+	if b.nomad == nil {
+		return []string{fmt.Sprintf("registered version %d", version)}, nil
+	}
+
+	versions, diffs, _, err := b.nomad.Jobs().Versions(stringValue(job.ID), true,
+		&api.QueryOptions{Namespace: stringValue(job.Namespace)})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching job versions: %w", err)
+	}
+
+	// versions are sorted newest first, diffs[i] is the diff of versions[i] to versions[i+1]
+	for i, v := range versions {
+		if uint64Value(v.Version) != version {
+			continue
+		}
+		if i >= len(diffs) || diffs[i] == nil {
+			return nil, nil
+		}
+		return summarizeJobDiff(diffs[i]), nil
+	}
+	return nil, fmt.Errorf("version %d of job %s not found", version, stringValue(job.ID))
+}
+
+// jobCacheVersions is how many versions of a job are cached, as many as nomad keeps by default.
+const jobCacheVersions = 6
+
+type jobCacheKey struct {
+	namespace, id string
+}
+
+// jobCache keeps the jobs read per namespace, ID and version, from nomad or from job events,
+// so the events of a deployment do not read its job from nomad every time.
+type jobCache struct {
+	mu   sync.Mutex
+	jobs map[jobCacheKey]map[uint64]*api.Job
+}
+
+func newJobCache() *jobCache {
+	return &jobCache{jobs: make(map[jobCacheKey]map[uint64]*api.Job)}
+}
+
+// get returns the cached job of version, nil if it is not cached.
+func (c *jobCache) get(namespace, id string, version uint64) *api.Job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.jobs[jobCacheKey{namespace, id}][version]
+}
+
+// put caches job, evicting the oldest versions of it beyond jobCacheVersions.
+func (c *jobCache) put(namespace string, job *api.Job) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := jobCacheKey{namespace, stringValue(job.ID)}
+	versions, ok := c.jobs[key]
+	if !ok {
+		versions = make(map[uint64]*api.Job)
+		c.jobs[key] = versions
+	}
+	versions[uint64Value(job.Version)] = job
+
+	for len(versions) > jobCacheVersions {
+		oldest := uint64(math.MaxUint64)
+		for v := range versions {
+			oldest = min(oldest, v)
+		}
+		delete(versions, oldest)
+	}
+}
+
+func (c *jobCache) delete(namespace, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.jobs, jobCacheKey{namespace, id})
+}
@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestSummarizeJobDiff(t *testing.T) {
+	diff := &api.JobDiff{
+		Type: "Edited",
+		Fields: []*api.FieldDiff{
+			{Type: "Edited", Name: "Priority", Old: "50", New: "70"},
+			{Type: "None", Name: "Datacenters", Old: "dc1", New: "dc1"},
+		},
+		TaskGroups: []*api.TaskGroupDiff{
+			{Type: "Added", Name: "worker"},
+			{Type: "Deleted", Name: "legacy"},
+			{Type: "None", Name: "unchanged"},
+			{
+				Type: "Edited",
+				Name: "web",
+				Fields: []*api.FieldDiff{
+					{Type: "Edited", Name: "Count", Old: "2", New: "3"},
+				},
+				Tasks: []*api.TaskDiff{
+					{Type: "Added", Name: "sidecar"},
+					{
+						Type: "Edited",
+						Name: "app",
+						Objects: []*api.ObjectDiff{
+							{Type: "Edited", Name: "Config", Fields: []*api.FieldDiff{
+								{Type: "Edited", Name: "image", Old: "app:1", New: "app:2"},
+								{Type: "Added", Name: "args", New: "--verbose"},
+							}},
+							{Type: "Edited", Name: "Resources", Fields: []*api.FieldDiff{
+								{Type: "Edited", Name: "MemoryMB", Old: "256", New: "512"},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	want := []string{
+		"+ group worker",
+		"- group legacy",
+		"+ task web/sidecar",
+		"~ web Count: 2 → 3",
+		"~ web/app Config.image: app:1 → app:2",
+		"~ web/app Resources.MemoryMB: 256 → 512",
+		"~ Priority: 50 → 70",
+		"+ web/app Config.args: --verbose",
+	}
+	if got := summarizeJobDiff(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("summarizeJobDiff() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestSummarizeJobDiffLimit(t *testing.T) {
+	diff := &api.JobDiff{Type: "Edited"}
+	for i := 0; i < maxJobChangeLines+5; i++ {
+		diff.Fields = append(diff.Fields, &api.FieldDiff{Type: "Edited", Name: fmt.Sprintf("Field%d", i), Old: "a", New: "b"})
+	}
+
+	got := summarizeJobDiff(diff)
+	if len(got) != maxJobChangeLines+1 {
+		t.Fatalf("summarizeJobDiff() has %d lines, want %d", len(got), maxJobChangeLines+1)
+	}
+	if last := got[len(got)-1]; last != "... and 5 more changes" {
+		t.Errorf("last line = %q", last)
+	}
+}
+
+func TestLookupJobVersionCached(t *testing.T) {
+	var reads atomic.Int32
+	version := uint64(3)
+	job := func(v uint64) api.Job {
+		return api.Job{ID: stringPtr("web"), Namespace: stringPtr("prod"), Version: &v, Meta: map[string]string{"v": fmt.Sprint(v)}}
+	}
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Nomad-Index", "1")
+		latest := atomic.LoadUint64(&version)
+		switch r.URL.Path {
+		case "/v1/job/web":
+			reads.Add(1)
+			_ = json.NewEncoder(w).Encode(job(latest))
+		case "/v1/job/web/versions":
+			reads.Add(1)
+			var resp api.JobVersionsResponse
+			for v := latest; v > 0; v-- {
+				j := job(v)
+				resp.Versions = append(resp.Versions, &j)
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer nomad.Close()
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestBot(t)
+	b.nomad = client
+	b.jobs = newJobCache()
+
+	lookup := func(v uint64, wantReads int32) {
+		t.Helper()
+		job := b.lookupJobVersion("prod", "web", v)
+		if job == nil || uint64Value(job.Version) != v || job.Meta["v"] != fmt.Sprint(v) {
+			t.Fatalf("lookupJobVersion(%d) = %+v", v, job)
+		}
+		if got := reads.Load(); got != wantReads {
+			t.Errorf("lookupJobVersion(%d): %d reads, want %d", v, got, wantReads)
+		}
+	}
+
+	lookup(3, 1)
+	lookup(3, 1)
+
+	// a new version is read again
+	atomic.StoreUint64(&version, 4)
+	lookup(4, 2)
+	lookup(4, 2)
+
+	// events of the deployment of the previous version keep using it
+	lookup(3, 2)
+
+	// an older version not cached yet is read from the job versions once
+	lookup(1, 4)
+	lookup(1, 4)
+	lookup(2, 4)
+
+	// job events update the cache without reading the job, the diff is not read either without nomad
+	b.nomad = nil
+	v5 := uint64(5)
+	if err := b.UpsertJobMsg(structs.TypeJobRegistered, api.Job{ID: stringPtr("web"), Namespace: stringPtr("prod"), Version: &v5}); err != nil {
+		t.Fatal(err)
+	}
+	if job := b.jobs.get("prod", "web", 5); job == nil {
+		t.Error("job of the registration event not cached")
+	}
+	if err := b.UpsertJobMsg(structs.TypeJobDeregistered, api.Job{ID: stringPtr("web"), Namespace: stringPtr("prod")}); err != nil {
+		t.Fatal(err)
+	}
+	if job := b.jobs.get("prod", "web", 5); job != nil {
+		t.Error("deregistered job still cached")
+	}
+}
+
+func TestJobCacheEvictsOldVersions(t *testing.T) {
+	c := newJobCache()
+	for v := uint64(1); v <= jobCacheVersions+2; v++ {
+		version := v
+		c.put("prod", &api.Job{ID: stringPtr("web"), Version: &version})
+	}
+	for v := uint64(1); v <= jobCacheVersions+2; v++ {
+		if cached := c.get("prod", "web", v) != nil; cached != (v > 2) {
+			t.Errorf("version %d cached = %v", v, cached)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
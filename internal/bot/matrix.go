@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// matrix messages are m.room.message events sent through the client-server api,
+// edits are events replacing the original one.
+// ref https://spec.matrix.org/v1.10/client-server-api/#mroommessage
+// ref https://spec.matrix.org/v1.10/client-server-api/#event-replacements
+
+const matrixFormatHTML = "org.matrix.custom.html"
+
+type matrixContent struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+
+	NewContent *matrixContent  `json:"m.new_content,omitempty"`
+	RelatesTo  *matrixRelation `json:"m.relates_to,omitempty"`
+}
+
+type matrixRelation struct {
+	RelType string `json:"rel_type"`
+	EventID string `json:"event_id"`
+}
+
+type matrixResponse struct {
+	EventID string `json:"event_id"`
+	ErrCode string `json:"errcode"`
+	Error   string `json:"error"`
+}
+
+func newMatrixBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Matrix) == 0 {
+		return nil, fmt.Errorf("please set matrix homeserver url, access token and room id to enable matrix bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.Matrix {
+		if c.HomeserverURL == "" || c.AccessToken == "" || c.RoomID == "" {
+			return nil, fmt.Errorf("matrix %q: homeserver url, access token and room id are required", c.Name)
+		}
+		client := resty.New().
+			SetBaseURL(strings.TrimSuffix(c.HomeserverURL, "/") + "/_matrix/client/v3").
+			SetAuthToken(c.AccessToken)
+		bots = append(bots, &matrixBot{
+			name:   c.Name,
+			client: client,
+			roomID: c.RoomID,
+			L:      slog.With("bot", "matrix", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+type matrixBot struct {
+	mu     sync.Mutex
+	name   string
+	roomID string
+	client *resty.Client
+	L      *slog.Logger
+}
+
+func (b *matrixBot) Name() string {
+	return b.name
+}
+
+func (b *matrixBot) Type() string {
+	return "matrix"
+}
+
+func (b *matrixBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	eventID, err := b.send(b.content(n))
+	if err != nil {
+		return "", fmt.Errorf("failed to send message, err=%w", err)
+	}
+	b.L.Debug("created message success", "event_id", eventID, "kind", n.Kind, "key", n.Key)
+
+	return eventID, nil
+}
+
+// Update replaces the original event, clients show the latest replacement in its place.
+// Replacements always relate to the original event, never to an earlier replacement.
+func (b *matrixBot) Update(eventID string, n Notification) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	newContent := b.content(n)
+	// the fallback shown by clients not supporting edits
+	content := matrixContent{
+		MsgType:       newContent.MsgType,
+		Body:          "* " + newContent.Body,
+		Format:        newContent.Format,
+		FormattedBody: "* " + newContent.FormattedBody,
+		NewContent:    &newContent,
+		RelatesTo:     &matrixRelation{RelType: "m.replace", EventID: eventID},
+	}
+
+	if _, err := b.send(content); err != nil {
+		return fmt.Errorf("failed to update previous message, id=%v, err=%w", eventID, err)
+	}
+	b.L.Debug("updated message", "event_id", eventID, "kind", n.Kind, "key", n.Key)
+
+	return nil
+}
+
+// send sends content to the room and returns the ID of the event.
+// ref https://spec.matrix.org/v1.10/client-server-api/#put_matrixclientv3roomsroomidsendeventtypetxnid
+func (b *matrixBot) send(content matrixContent) (string, error) {
+	var r matrixResponse
+	res, err := b.client.R().
+		SetBody(content).
+		SetResult(&r).
+		SetError(&r).
+		SetPathParams(map[string]string{"room_id": b.roomID, "txn_id": newTxnID()}).
+		Put("/rooms/{room_id}/send/m.room.message/{txn_id}")
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode() >= 300 {
+		if r.ErrCode != "" {
+			return "", fmt.Errorf("%s: %s, code=%v", r.ErrCode, r.Error, res.StatusCode())
+		}
+		return "", fmt.Errorf("%s, code=%v", res.Body(), res.StatusCode())
+	}
+	return r.EventID, nil
+}
+
+// newTxnID makes every request a new event, the homeserver deduplicates retries of the same transaction ID.
+func newTxnID() string {
+	var r [16]byte
+	_, _ = rand.Read(r[:])
+	return hex.EncodeToString(r[:])
+}
+
+// content renders n as a notice with a plain text body and a HTML formatted body.
+// ref https://spec.matrix.org/v1.10/client-server-api/#mroommessage-msgtypes
+func (b *matrixBot) content(n Notification) matrixContent {
+	var text, formatted strings.Builder
+
+	title := html.EscapeString(n.Title)
+	if n.URL != "" {
+		title = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(n.URL), title)
+	}
+	fmt.Fprintf(&formatted, `<b><font data-mx-color="%s">%s</font></b>`, slackColorForSeverity(n.Severity), title)
+	text.WriteString(n.Title)
+	if n.URL != "" {
+		text.WriteString(" " + n.URL)
+	}
+
+	if n.Summary != "" {
+		formatted.WriteString("<br>" + html.EscapeString(n.Summary))
+		text.WriteString("\n" + n.Summary)
+	}
+	for _, f := range n.Fields {
+		value := strings.TrimSpace(f.Value)
+		formatted.WriteString("<br><b>" + html.EscapeString(f.Title) + "</b>")
+		if strings.Contains(value, "\n") {
+			formatted.WriteString("<pre><code>" + html.EscapeString(value) + "</code></pre>")
+		} else {
+			formatted.WriteString("<br>" + html.EscapeString(value))
+		}
+		text.WriteString("\n\n" + f.Title + "\n" + value)
+	}
+	if len(n.Links) > 0 {
+		var links []string
+		for _, l := range n.Links {
+			links = append(links, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(l.URL), html.EscapeString(l.Title)))
+			text.WriteString("\n" + l.Title + ": " + l.URL)
+		}
+		formatted.WriteString("<br>" + strings.Join(links, " | "))
+	}
+	if n.Footer != "" {
+		formatted.WriteString("<br><sub>" + html.EscapeString(n.Footer) + "</sub>")
+		text.WriteString("\n\n" + n.Footer)
+	}
+
+	return matrixContent{
+		MsgType:       "m.notice",
+		Body:          text.String(),
+		Format:        matrixFormatHTML,
+		FormattedBody: formatted.String(),
+	}
+}
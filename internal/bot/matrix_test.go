@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMatrixPostUpdate(t *testing.T) {
+	var sent []matrixContent
+	txnIDs := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"Invalid access token"}`))
+			return
+		}
+		prefix := "/_matrix/client/v3/rooms/!room:example.com/send/m.room.message/"
+		if r.Method != http.MethodPut || !strings.HasPrefix(r.URL.Path, prefix) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		txnIDs[strings.TrimPrefix(r.URL.Path, prefix)] = true
+
+		var c matrixContent
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			t.Error(err)
+		}
+		sent = append(sent, c)
+		_, _ = w.Write([]byte(`{"event_id":"$event` + strconv.Itoa(len(sent)) + `"}`))
+	}))
+	defer srv.Close()
+
+	newBot := func(token string) *matrixBot {
+		impls, err := newMatrixBot(Config{Matrix: []MatrixConfig{{
+			Instance: Instance{Name: "matrix"}, HomeserverURL: srv.URL + "/", AccessToken: token, RoomID: "!room:example.com",
+		}}}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return impls[0].(*matrixBot)
+	}
+	b := newBot("token")
+
+	n := Notification{Title: "web <deploy>", URL: "https://nomad/ui", Summary: "running", Fields: []Field{{Title: "Events", Value: "a\nb"}}}
+	id, err := b.Post(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "$event1" {
+		t.Errorf("Post() = %q, want $event1", id)
+	}
+	n.Summary = "successful"
+	if err := b.Update(id, n); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 2 || len(txnIDs) != 2 {
+		t.Fatalf("sent %d events with %d transaction ids, want 2", len(sent), len(txnIDs))
+	}
+	post, edit := sent[0], sent[1]
+	if post.MsgType != "m.notice" || !strings.Contains(post.FormattedBody, `<a href="https://nomad/ui">web &lt;deploy&gt;</a>`) ||
+		!strings.Contains(post.FormattedBody, "<pre><code>a\nb</code></pre>") {
+		t.Errorf("posted content = %+v", post)
+	}
+	if edit.RelatesTo == nil || edit.RelatesTo.RelType != "m.replace" || edit.RelatesTo.EventID != "$event1" {
+		t.Errorf("edit relation = %+v", edit.RelatesTo)
+	}
+	if edit.NewContent == nil || !strings.Contains(edit.NewContent.Body, "successful") || !strings.HasPrefix(edit.Body, "* ") {
+		t.Errorf("edit content = %+v", edit)
+	}
+
+	if _, err := newBot("wrong").Post(n); err == nil || !strings.Contains(err.Error(), "M_UNKNOWN_TOKEN") {
+		t.Errorf("Post() error = %v, want the matrix error code", err)
+	}
+}
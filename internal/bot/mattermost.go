@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/slack-go/slack"
+)
+
+// mattermostPost is the subset of a mattermost post we send and read back.
+// ref https://api.mattermost.com/#tag/posts
+type mattermostPost struct {
+	ID        string         `json:"id,omitempty"`
+	ChannelID string         `json:"channel_id,omitempty"`
+	Message   string         `json:"message"`
+	Props     mattermostProp `json:"props"`
+}
+
+// mattermostProp carries slack compatible attachments.
+// ref https://developers.mattermost.com/integrate/reference/message-attachments/
+type mattermostProp struct {
+	Attachments []slack.Attachment `json:"attachments"`
+}
+
+func newMattermostBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Mattermost) == 0 {
+		return nil, fmt.Errorf("please set mattermost url, token and channel to enable mattermost bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.Mattermost {
+		if c.URL == "" || c.Token == "" || c.ChannelID == "" {
+			return nil, fmt.Errorf("mattermost %q: url, token and channel id are required", c.Name)
+		}
+		client := resty.New().
+			SetBaseURL(strings.TrimSuffix(c.URL, "/") + "/api/v4").
+			SetAuthToken(c.Token)
+		bots = append(bots, &mattermostBot{
+			name:      c.Name,
+			client:    client,
+			channelID: c.ChannelID,
+			L:         slog.With("bot", "mattermost", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+type mattermostBot struct {
+	mu        sync.Mutex
+	name      string
+	channelID string
+	client    *resty.Client
+	L         *slog.Logger
+}
+
+func (b *mattermostBot) Name() string {
+	return b.name
+}
+
+func (b *mattermostBot) Type() string {
+	return "mattermost"
+}
+
+func (b *mattermostBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	post := b.post(n)
+	post.ChannelID = b.channelID
+
+	// ref https://api.mattermost.com/#tag/posts/operation/CreatePost
+	var r mattermostPost
+	res, err := b.client.R().SetBody(post).SetResult(&r).Post("/posts")
+	if err != nil {
+		return "", fmt.Errorf("failed to post, err=%w", err)
+	}
+	if res.StatusCode() >= 300 {
+		return "", fmt.Errorf("failed to create post %s, code=%v", res.Body(), res.StatusCode())
+	}
+	b.L.Debug("created post success", "post_id", r.ID, "kind", n.Kind, "key", n.Key)
+
+	return r.ID, nil
+}
+
+func (b *mattermostBot) Update(postID string, n Notification) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// ref https://api.mattermost.com/#tag/posts/operation/PatchPost
+	res, err := b.client.R().SetBody(b.post(n)).SetPathParam("post_id", postID).Put("/posts/{post_id}/patch")
+	if err != nil {
+		return fmt.Errorf("failed to update previous post, id=%v, err=%w", postID, err)
+	}
+	if res.StatusCode() >= 300 {
+		return fmt.Errorf("failed to update previous post, %s, code=%v", res.Body(), res.StatusCode())
+	}
+	b.L.Debug("updated post", "post_id", postID, "kind", n.Kind, "key", n.Key)
+
+	return nil
+}
+
+func (b *mattermostBot) post(n Notification) mattermostPost {
+	return mattermostPost{
+		Props: mattermostProp{
+			Attachments: []slack.Attachment{slackAttachment(n, markdownLink)},
+		},
+	}
+}
+
+func markdownLink(l Link) string {
+	return fmt.Sprintf("[%s](%s)", l.Title, l.URL)
+}
@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+type mattermostRequest struct {
+	method, path string
+	post         mattermostPost
+}
+
+// mattermostStandIn serves the posts endpoints of the mattermost api, failing with status fail if set.
+type mattermostStandIn struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	fail     int
+	requests []mattermostRequest
+}
+
+func (s *mattermostStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.fail != 0 {
+		w.WriteHeader(s.fail)
+		_, _ = w.Write([]byte(`{"id":"api.post.create_post.channel_archived.error","status_code":` + strconv.Itoa(s.fail) + `}`))
+		return
+	}
+
+	var p mattermostPost
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		s.t.Error(err)
+	}
+	s.requests = append(s.requests, mattermostRequest{method: r.Method, path: r.URL.Path, post: p})
+	p.ID = "post" + strconv.Itoa(len(s.requests))
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+func newTestMattermostBots(t *testing.T, url string, channels ...string) []Impl {
+	t.Helper()
+	var cfg []MattermostConfig
+	for _, channel := range channels {
+		cfg = append(cfg, MattermostConfig{Instance: Instance{Name: channel}, URL: url + "/", Token: "token", ChannelID: channel})
+	}
+	impls, err := newMattermostBot(Config{Mattermost: cfg}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return impls
+}
+
+func TestMattermostPostThenPatch(t *testing.T) {
+	s := &mattermostStandIn{t: t}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	b := newTestBot(t, newTestMattermostBots(t, srv.URL, "ops")...)
+	n := Notification{Kind: KindDeployment, Key: "d1", Title: "web deployment", Summary: "running", TTL: time.Hour}
+	if err := b.send(n); err != nil {
+		t.Fatal(err)
+	}
+	n.Summary = "successful"
+	if err := b.send(n); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, ok, _ := b.cfg.Store.Get(store.Key{Backend: "ops", Kind: KindDeployment, ID: "d1"}); !ok || id != "post1" {
+		t.Errorf("stored post id = %q, %v, want post1", id, ok)
+	}
+	if len(s.requests) != 2 {
+		t.Fatalf("%d requests, want a create and a patch", len(s.requests))
+	}
+	create, patch := s.requests[0], s.requests[1]
+	if create.method != http.MethodPost || create.path != "/api/v4/posts" || create.post.ChannelID != "ops" {
+		t.Errorf("create = %s %s to channel %q", create.method, create.path, create.post.ChannelID)
+	}
+	if patch.method != http.MethodPut || patch.path != "/api/v4/posts/post1/patch" {
+		t.Errorf("patch = %s %s", patch.method, patch.path)
+	}
+	attachments := patch.post.Props.Attachments
+	if len(attachments) != 1 || attachments[0].AuthorName != "web deployment" || attachments[0].Title != "successful" {
+		t.Errorf("patched attachments = %+v", attachments)
+	}
+}
+
+func TestMattermostChannelPerInstance(t *testing.T) {
+	s := &mattermostStandIn{t: t}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for _, impl := range newTestMattermostBots(t, srv.URL, "ops", "dev") {
+		if _, err := impl.Post(Notification{Title: "web deployment"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.requests) != 2 || s.requests[0].post.ChannelID != "ops" || s.requests[1].post.ChannelID != "dev" {
+		t.Errorf("requests = %+v, want one post to each instance's channel", s.requests)
+	}
+}
+
+func TestMattermostError(t *testing.T) {
+	s := &mattermostStandIn{t: t, fail: http.StatusForbidden}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	b := newTestBot(t, newTestMattermostBots(t, srv.URL, "ops")...)
+	n := Notification{Kind: KindDeployment, Key: "d1", Title: "web deployment", TTL: time.Hour}
+	if err := b.send(n); err == nil || !strings.Contains(err.Error(), "code=403") {
+		t.Errorf("send() error = %v, want the status code", err)
+	}
+	if _, ok, _ := b.cfg.Store.Get(store.Key{Backend: "ops", Kind: KindDeployment, ID: "d1"}); ok {
+		t.Error("post id stored for a failed post")
+	}
+
+	impl := newTestMattermostBots(t, srv.URL, "ops")[0].(*mattermostBot)
+	if err := impl.Update("post1", n); err == nil || !strings.Contains(err.Error(), "code=403") {
+		t.Errorf("Update() error = %v, want the status code", err)
+	}
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+type nodeState struct {
+	status      string
+	eligibility string
+	draining    bool
+}
+
+func nodeStateOf(node api.Node) nodeState {
+	return nodeState{
+		status:      node.Status,
+		eligibility: node.SchedulingEligibility,
+		draining:    node.DrainStrategy != nil,
+	}
+}
+
+// nodeTracker remembers the last seen state of each node,
+// because eligibility, drain and status updates all arrive as whole node payloads.
+type nodeTracker struct {
+	mu    sync.Mutex
+	nodes map[string]nodeState
+}
+
+func newNodeTracker() *nodeTracker {
+	return &nodeTracker{nodes: make(map[string]nodeState)}
+}
+
+func nodeStatusUnhealthy(status string) bool {
+	return status == api.NodeStatusDown || status == api.NodeStatusDisconnected
+}
+
+// seed records the current state of the nodes, so the first event of each node after startup
+// is compared to it instead of being taken as the first sight of the node.
+func (t *nodeTracker) seed(nodes []*api.NodeListStub) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, node := range nodes {
+		t.nodes[node.ID] = nodeState{
+			status:      node.Status,
+			eligibility: node.SchedulingEligibility,
+			draining:    node.Drain,
+		}
+	}
+}
+
+// changes returns the notable changes of node since it was last seen:
+// going down or disconnected and back, drain start and finish, and eligibility flips.
+// For nodes seen the first time the change is inferred from the event type,
+// e.g. nodes registered after the tracker was seeded.
+func (t *nodeTracker) changes(eventType string, node api.Node) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cur := nodeStateOf(node)
+	prev, seen := t.nodes[node.ID]
+
+	if eventType == structs.TypeNodeDeregistration {
+		delete(t.nodes, node.ID)
+		return []string{"deregistered"}
+	}
+	t.nodes[node.ID] = cur
+
+	if !seen {
+		return firstChanges(eventType, node, cur)
+	}
+
+	var changes []string
+	if prev.status != cur.status && (nodeStatusUnhealthy(prev.status) || nodeStatusUnhealthy(cur.status)) {
+		changes = append(changes, fmt.Sprintf("status %s → %s", prev.status, cur.status))
+	}
+	if !prev.draining && cur.draining {
+		changes = append(changes, "drain started")
+	}
+	if prev.draining && !cur.draining {
+		result := "drain finished"
+		if node.LastDrain != nil {
+			result = fmt.Sprintf("drain %s", node.LastDrain.Status)
+		}
+		changes = append(changes, result)
+	}
+	if prev.eligibility != cur.eligibility {
+		changes = append(changes, fmt.Sprintf("eligibility %s → %s", prev.eligibility, cur.eligibility))
+	}
+	return changes
+}
+
+// firstChanges infers the changes of a node not seen before from the event,
+// the previous state is unknown so only the current one is reported.
+func firstChanges(eventType string, node api.Node, cur nodeState) []string {
+	var changes []string
+	if nodeStatusUnhealthy(cur.status) {
+		changes = append(changes, fmt.Sprintf("status %s", cur.status))
+	}
+	switch eventType {
+	case structs.TypeNodeDrain:
+		if cur.draining {
+			changes = append(changes, "drain started")
+		} else if node.LastDrain != nil {
+			changes = append(changes, fmt.Sprintf("drain %s", node.LastDrain.Status))
+		}
+	case structs.TypeNodeEligibilityUpdate:
+		changes = append(changes, fmt.Sprintf("eligibility %s", cur.eligibility))
+	}
+	return changes
+}
+
+// nodeSeverity maps the node state to a severity.
+func nodeSeverity(node api.Node) Severity {
+	switch {
+	case nodeStatusUnhealthy(node.Status):
+		return SeverityError
+	case node.DrainStrategy != nil || node.SchedulingEligibility == api.NodeSchedulingIneligible:
+		return SeverityWarning
+	case node.Status == api.NodeStatusReady:
+		return SeveritySuccess
+	default:
+		return SeverityUnknown
+	}
+}
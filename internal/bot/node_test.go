@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestNodeTrackerChanges(t *testing.T) {
+	ready := api.Node{ID: "n1", Status: api.NodeStatusReady, SchedulingEligibility: api.NodeSchedulingEligible}
+	draining := ready
+	draining.DrainStrategy = &api.DrainStrategy{}
+	draining.SchedulingEligibility = api.NodeSchedulingIneligible
+	drained := draining
+	drained.DrainStrategy = nil
+	drained.LastDrain = &api.DrainMetadata{Status: api.DrainStatusComplete}
+	down := ready
+	down.Status = api.NodeStatusDown
+
+	tr := newNodeTracker()
+	steps := []struct {
+		eventType string
+		node      api.Node
+		want      []string
+	}{
+		{structs.TypeNodeRegistration, ready, nil},
+		{structs.TypeNodeEvent, ready, nil},
+		{structs.TypeNodeDrain, draining, []string{"drain started", "eligibility eligible → ineligible"}},
+		{structs.TypeNodeDrain, drained, []string{"drain complete"}},
+		{structs.TypeNodeEligibilityUpdate, ready, []string{"eligibility ineligible → eligible"}},
+		{structs.TypeNodeEvent, down, []string{"status ready → down"}},
+		{structs.TypeNodeEvent, ready, []string{"status down → ready"}},
+		{structs.TypeNodeDeregistration, ready, []string{"deregistered"}},
+	}
+	for i, step := range steps {
+		got := tr.changes(step.eventType, step.node)
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d %s: changes() = %q, want %q", i, step.eventType, got, step.want)
+		}
+	}
+}
+
+func TestNodeTrackerFirstEvent(t *testing.T) {
+	draining := api.Node{ID: "n1", Status: api.NodeStatusReady, SchedulingEligibility: api.NodeSchedulingIneligible,
+		DrainStrategy: &api.DrainStrategy{}}
+	ineligible := api.Node{ID: "n2", Status: api.NodeStatusReady, SchedulingEligibility: api.NodeSchedulingIneligible}
+	down := api.Node{ID: "n3", Status: api.NodeStatusDown}
+	ready := api.Node{ID: "n4", Status: api.NodeStatusReady}
+
+	tests := []struct {
+		eventType string
+		node      api.Node
+		want      []string
+	}{
+		{structs.TypeNodeDrain, draining, []string{"drain started"}},
+		{structs.TypeNodeEligibilityUpdate, ineligible, []string{"eligibility ineligible"}},
+		{structs.TypeNodeEvent, down, []string{"status down"}},
+		{structs.TypeNodeRegistration, ready, nil},
+	}
+	for _, tt := range tests {
+		got := newNodeTracker().changes(tt.eventType, tt.node)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s of unseen %s: changes() = %q, want %q", tt.eventType, tt.node.ID, got, tt.want)
+		}
+	}
+}
+
+func TestNodeTrackerSeed(t *testing.T) {
+	tr := newNodeTracker()
+	tr.seed([]*api.NodeListStub{
+		{ID: "n1", Status: api.NodeStatusReady, SchedulingEligibility: api.NodeSchedulingEligible},
+	})
+
+	node := api.Node{ID: "n1", Status: api.NodeStatusReady, SchedulingEligibility: api.NodeSchedulingIneligible,
+		DrainStrategy: &api.DrainStrategy{}}
+	want := []string{"drain started", "eligibility eligible → ineligible"}
+	if got := tr.changes(structs.TypeNodeDrain, node); !reflect.DeepEqual(got, want) {
+		t.Errorf("first drain of seeded node: changes() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+	"github.com/ttys3/nomad-event-notifier/version"
+)
+
+// Kinds of notifications, also used as the kind of their message store keys.
+const (
+	KindDeployment = store.KindDeployment
+	KindAllocation = store.KindAllocation
+	KindJob        = "job"
+	KindNode       = "node"
+	KindEvaluation = "evaluation"
+	KindService    = "service"
+)
+
+type Severity string
+
+const (
+	SeverityUnknown Severity = ""
+	SeverityInfo    Severity = "info"
+	SeveritySuccess Severity = "success"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// severityForStatus maps nomad deployment and allocation statuses to a severity.
+func severityForStatus(status string) Severity {
+	switch status {
+	case "failed":
+		return SeverityError
+	case "running":
+		return SeverityInfo
+	case "successful":
+		return SeveritySuccess
+	default:
+		return SeverityUnknown
+	}
+}
+
+type Field struct {
+	Title string
+	Value string
+	// Short fields may be rendered side by side
+	Short bool
+}
+
+type Link struct {
+	Title string
+	URL   string
+}
+
+type Confirm struct {
+	Title       string
+	Text        string
+	OkText      string
+	DismissText string
+}
+
+// Action is a button acting on nomad, only rendered by backends supporting interactivity.
+type Action struct {
+	Name    string
+	Text    string
+	Value   string
+	Style   string
+	Confirm *Confirm
+}
+
+// Notification is the backend neutral message built once from a nomad event,
+// each Impl only renders it to its wire format.
+type Notification struct {
+	Kind string
+	// Key correlates notifications about the same object, e.g. the deployment ID.
+	// Backends able to edit messages update the message posted for the same key,
+	// an empty key always posts a new message.
+	Key string
+	// TTL is how long the message of Key is tracked for updates
+	TTL time.Duration
+	// Subject selects the backend instances through routes
+	Subject Subject
+
+	Title string
+	// Summary is an optional one line status, e.g. the deployment status description
+	Summary  string
+	Severity Severity
+	// URL is the primary link, e.g. to the deployment in the nomad UI
+	URL     string
+	Fields  []Field
+	Links   []Link
+	Actions []Action
+	Footer  string
+
+	// data renders the title, summary, fields and footer through Templates if set
+	data *TemplateData
+}
+
+func footer(parts ...string) string {
+	return strings.Join(append([]string{fmt.Sprintf("nomad-event-notifier: %s", version.Version)}, parts...), " | ")
+}
+
+// deploymentNotification builds the notification for deploy, job may be nil if unknown.
+func deploymentNotification(deploy api.Deployment, job *api.Job, nomadAddress string) Notification {
+	var actions []Action
+	if deploy.StatusDescription == "Deployment is running but requires manual promotion" {
+		actions = []Action{
+			{
+				Name:  actionPromote,
+				Text:  "Promote :heavy_check_mark:",
+				Value: deploymentActionValue(deploy),
+			},
+			{
+				Name:  actionFail,
+				Text:  "Fail :boom:",
+				Style: "danger",
+				Value: deploymentActionValue(deploy),
+				Confirm: &Confirm{
+					Title:       "Are you sure?",
+					Text:        ":nomad-sad: :nomad-sad: :nomad-sad: :nomad-sad: :nomad-sad:",
+					OkText:      "Fail",
+					DismissText: "Woops!",
+				},
+			},
+		}
+	}
+
+	data := newTemplateData(job, nomadAddress)
+	data.Deployment = &deploy
+
+	subject := jobSubject(deploy.Namespace, deploy.JobID, job)
+	subject.TaskGroups = sortedKeys(deploy.TaskGroups)
+	subject.Payload = deploy
+
+	return Notification{
+		Kind:     KindDeployment,
+		Key:      deploy.ID,
+		Subject:  subject,
+		Severity: severityForStatus(deploy.Status),
+		URL:      fmt.Sprintf("%s/ui/jobs/%s/deployments", nomadAddress, deploy.JobID),
+		Actions:  actions,
+		data:     data,
+	}
+}
+
+// taskEventsText renders the events of a task one per line, with the details explaining kills and exits.
+func taskEventsText(state *api.TaskState) string {
+	var b strings.Builder
+	for _, event := range state.Events {
+		fmt.Fprintf(&b, "*%s*: %s %s", event.Type, event.DisplayMessage, event.Details["driver_message"])
+		var keys []string
+		switch event.Type {
+		case structs.TaskTerminated:
+			keys = []string{"exit_code", "signal"}
+		case structs.TaskKilled:
+			keys = []string{"kill_reason", "kill_error", "kill_timeout"}
+		}
+		for _, key := range keys {
+			if val, ok := event.Details[key]; ok && val != "" {
+				fmt.Fprintf(&b, ", %s: %s", key, val)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func allocationNotification(alloc api.Allocation, findings []classify.Finding, nomadAddress string) Notification {
+	data := newTemplateData(alloc.Job, nomadAddress)
+	data.Allocation = &alloc
+	for _, taskName := range sortedKeys(alloc.TaskStates) {
+		task := TaskData{Name: taskName, State: alloc.TaskStates[taskName]}
+		for _, f := range findings {
+			if f.Task == taskName {
+				task.Findings = append(task.Findings, f)
+			}
+		}
+		if len(task.Findings) == 0 || task.State == nil {
+			continue
+		}
+		data.Tasks = append(data.Tasks, task)
+	}
+
+	subject := jobSubject(alloc.Namespace, alloc.JobID, alloc.Job)
+	subject.TaskGroups = []string{alloc.TaskGroup}
+	subject.Payload = alloc
+
+	return Notification{
+		Kind:     KindAllocation,
+		Key:      alloc.ID,
+		Subject:  subject,
+		Severity: severityForStatus(alloc.ClientStatus),
+		URL:      fmt.Sprintf("%s/ui/allocations/%s", nomadAddress, alloc.ID),
+		Links: []Link{
+			{Title: fmt.Sprintf("%s/%s", alloc.JobID, alloc.TaskGroup), URL: fmt.Sprintf("%s/ui/jobs/%s/%s", nomadAddress, alloc.JobID, alloc.TaskGroup)},
+		},
+		data: data,
+	}
+}
+
+func jobNotification(eventType string, job api.Job, changes []string, nomadAddress string) Notification {
+	jobID := stringValue(job.ID)
+	subject := jobSubject(stringValue(job.Namespace), jobID, &job)
+	for _, tg := range job.TaskGroups {
+		subject.TaskGroups = append(subject.TaskGroups, stringValue(tg.Name))
+	}
+	subject.Payload = job
+
+	return Notification{
+		Kind:     KindJob,
+		Subject:  subject,
+		Title:    fmt.Sprintf("job %s %s, version %d", jobID, eventType, uint64Value(job.Version)),
+		Severity: severityForStatus(stringValue(job.Status)),
+		URL:      fmt.Sprintf("%s/ui/jobs/%s/versions", nomadAddress, jobID),
+		Fields: []Field{
+			{Title: "Namespace", Value: stringValue(job.Namespace), Short: true},
+			{Title: "Type", Value: stringValue(job.Type), Short: true},
+			{Title: "Changes", Value: "```\n" + strings.Join(changes, "\n") + "\n```"},
+		},
+		Footer: footer(),
+	}
+}
+
+func nodeNotification(node api.Node, changes []string, nomadAddress string) Notification {
+	return Notification{
+		Kind:     KindNode,
+		Subject:  Subject{NodePool: node.NodePool, Payload: node},
+		Title:    fmt.Sprintf("node %s: %s", node.Name, strings.Join(changes, ", ")),
+		Severity: nodeSeverity(node),
+		URL:      fmt.Sprintf("%s/ui/clients/%s", nomadAddress, node.ID),
+		Fields: []Field{
+			{Title: "Datacenter", Value: node.Datacenter, Short: true},
+			{Title: "Node Pool", Value: node.NodePool, Short: true},
+			{Title: "Status", Value: node.Status, Short: true},
+			{Title: "Eligibility", Value: node.SchedulingEligibility, Short: true},
+			{Title: "Node ID", Value: node.ID},
+		},
+		Footer: footer(),
+	}
+}
+
+func evalNotification(eval api.Evaluation, job *api.Job, failures []PlacementFailure, nomadAddress string) Notification {
+	fields := []Field{
+		{Title: "Status", Value: eval.Status, Short: true},
+		{Title: "Triggered By", Value: eval.TriggeredBy, Short: true},
+	}
+	if eval.StatusDescription != "" {
+		fields = append(fields, Field{Title: "Description", Value: eval.StatusDescription})
+	}
+	for _, f := range failures {
+		fields = append(fields, Field{
+			Title: fmt.Sprintf("Task Group: %s", f.TaskGroup),
+			Value: strings.Join(f.Details, "\n"),
+		})
+	}
+
+	subject := jobSubject(eval.Namespace, eval.JobID, job)
+	for _, f := range failures {
+		subject.TaskGroups = append(subject.TaskGroups, f.TaskGroup)
+	}
+	subject.Payload = eval
+
+	return Notification{
+		Kind:     KindEvaluation,
+		Subject:  subject,
+		Title:    fmt.Sprintf("%s failed to place allocations", eval.JobID),
+		Severity: SeverityError,
+		URL:      fmt.Sprintf("%s/ui/jobs/%s", nomadAddress, eval.JobID),
+		Fields:   fields,
+		Footer:   footer(fmt.Sprintf("Evaluation ID: %s", eval.ID)),
+	}
+}
+
+func serviceNotification(eventType string, service api.ServiceRegistration, nomadAddress string) Notification {
+	return Notification{
+		Kind:    KindService,
+		Subject: Subject{Namespace: service.Namespace, JobID: service.JobID, Payload: service},
+		Title:   fmt.Sprintf("%s %s", service.ServiceName, eventType),
+		URL:     fmt.Sprintf("%s/ui/jobs/%s/services", nomadAddress, service.JobID),
+		Fields: []Field{
+			{Title: "Job", Value: service.JobID, Short: true},
+			{Title: "Address", Value: fmt.Sprintf("%s:%d", service.Address, service.Port), Short: true},
+			{Title: "Allocation", Value: service.AllocID},
+		},
+		Footer: footer(),
+	}
+}
@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// opsgenie alerts are created and closed through the alert api, alerts with the same alias are one alert.
+// ref https://docs.opsgenie.com/docs/alert-api
+
+const (
+	// limits of the alert fields
+	opsgenieMessageLimit     = 130
+	opsgenieDescriptionLimit = 15000
+	opsgenieTagLimit         = 50
+	opsgenieTagsLimit        = 20
+)
+
+// opsgeniePriorities are the default priorities of the alerts by notification kind.
+var opsgeniePriorities = map[string]string{
+	KindDeployment: "P2",
+	KindAllocation: "P3",
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+type opsgenieResponse struct {
+	Result    string `json:"result"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+}
+
+func newOpsgenieBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Opsgenie) == 0 {
+		return nil, fmt.Errorf("please set opsgenie api key to enable opsgenie bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.Opsgenie {
+		if c.APIKey == "" {
+			return nil, fmt.Errorf("opsgenie %q: api key is required", c.Name)
+		}
+		priorities := make(map[string]string)
+		for kind, p := range opsgeniePriorities {
+			priorities[kind] = p
+		}
+		for kind, p := range c.Priorities {
+			if !validOpsgeniePriority(p) {
+				return nil, fmt.Errorf("opsgenie %q: invalid priority %q of %s", c.Name, p, kind)
+			}
+			priorities[kind] = p
+		}
+		apiURL := c.APIURL
+		if apiURL == "" {
+			apiURL = "https://api.opsgenie.com"
+		}
+
+		bots = append(bots, &opsgenieBot{
+			name:       c.Name,
+			priorities: priorities,
+			client: resty.New().
+				SetBaseURL(strings.TrimSuffix(apiURL, "/")).
+				SetHeader("Authorization", "GenieKey "+c.APIKey),
+			incidents: incidents{backend: c.Name, store: cfg.Store},
+			L:         slog.With("bot", "opsgenie", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+// validOpsgeniePriority reports whether p is one of P1 to P5.
+func validOpsgeniePriority(p string) bool {
+	return len(p) == 2 && p[0] == 'P' && p[1] >= '1' && p[1] <= '5'
+}
+
+// opsgenieBot creates an alert for failed deployments and failed allocations,
+// the alerts of a job are closed once a later deployment of it succeeds.
+type opsgenieBot struct {
+	mu         sync.Mutex
+	name       string
+	priorities map[string]string
+	client     *resty.Client
+	incidents  incidents
+	L          *slog.Logger
+}
+
+func (b *opsgenieBot) Name() string {
+	return b.name
+}
+
+func (b *opsgenieBot) Type() string {
+	return "opsgenie"
+}
+
+func (b *opsgenieBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case n.Kind == KindDeployment && n.Severity == SeveritySuccess:
+		return "", b.close(n)
+	case (n.Kind == KindDeployment || n.Kind == KindAllocation) && n.Severity == SeverityError:
+		return b.create(n)
+	default:
+		return "", nil
+	}
+}
+
+// ref https://docs.opsgenie.com/docs/alert-api#create-alert
+func (b *opsgenieBot) create(n Notification) (string, error) {
+	alert := b.alert(n)
+	if err := b.call(alert, "/v2/alerts", nil); err != nil {
+		return "", fmt.Errorf("failed to create alert %s: %w", alert.Alias, err)
+	}
+	b.L.Debug("created alert", "kind", n.Kind, "key", n.Key, "alias", alert.Alias)
+
+	if err := b.incidents.add(n.Subject, alert.Alias); err != nil {
+		return "", err
+	}
+	return alert.Alias, nil
+}
+
+// close closes the alerts created for the job of the successful deployment n.
+// ref https://docs.opsgenie.com/docs/alert-api#close-alert
+func (b *opsgenieBot) close(n Notification) error {
+	open, err := b.incidents.open(n.Subject)
+	if err != nil || len(open) == 0 {
+		return err
+	}
+
+	body := opsgenieClose{
+		Source: "nomad-event-notifier",
+		Note:   fmt.Sprintf("deployment %s of %s succeeded", shortID(n.Key), n.Subject.JobID),
+	}
+	for i, alias := range open {
+		err := b.call(body, "/v2/alerts/{alias}/close", map[string]string{"alias": alias})
+		if err != nil {
+			// keep the alerts not closed yet for the next successful deployment
+			if serr := b.incidents.set(n.Subject, open[i:]); serr != nil {
+				b.L.Warn("error saving open alerts", "job_id", n.Subject.JobID, "error", serr)
+			}
+			return fmt.Errorf("failed to close alert %s: %w", alias, err)
+		}
+		b.L.Debug("closed alert", "kind", n.Kind, "key", n.Key, "alias", alias)
+	}
+	return b.incidents.set(n.Subject, nil)
+}
+
+// call posts body to path, alerts are identified by alias in pathParams.
+// Requests are processed asynchronously by opsgenie, errors of the processing are not seen.
+func (b *opsgenieBot) call(body any, path string, pathParams map[string]string) error {
+	var r opsgenieResponse
+	req := b.client.R().SetBody(body).SetResult(&r).SetError(&r)
+	if pathParams != nil {
+		req.SetPathParams(pathParams).SetQueryParam("identifierType", "alias")
+	}
+	res, err := req.Post(path)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode() >= 300 {
+		if r.Message != "" {
+			return fmt.Errorf("%s, code=%v", r.Message, res.StatusCode())
+		}
+		return fmt.Errorf("%s, code=%v", res.Body(), res.StatusCode())
+	}
+	return nil
+}
+
+func (b *opsgenieBot) alert(n Notification) opsgenieAlert {
+	message := n.Title
+	if n.Summary != "" {
+		message += ": " + n.Summary
+	}
+
+	var description strings.Builder
+	for _, f := range n.Fields {
+		description.WriteString(f.Title + "\n" + strings.TrimSpace(f.Value) + "\n\n")
+	}
+	if n.URL != "" {
+		description.WriteString(n.URL + "\n")
+	}
+
+	alert := opsgenieAlert{
+		Message:     truncate(message, opsgenieMessageLimit),
+		Alias:       opsgenieAlias(n),
+		Description: truncate(description.String(), opsgenieDescriptionLimit),
+		Tags:        opsgenieTags(n.Subject),
+		Details:     map[string]string{"namespace": n.Subject.Namespace, "job_id": n.Subject.JobID},
+		Entity:      n.Subject.JobID,
+		Source:      "nomad-event-notifier",
+		Priority:    b.priorities[n.Kind],
+	}
+	if n.URL != "" {
+		alert.Details["url"] = n.URL
+	}
+	if deployID := deploymentIDOf(n); deployID != "" {
+		alert.Details["deployment_id"] = deployID
+	}
+	return alert
+}
+
+// opsgenieAlias makes the alerts about one deployment a single alert,
+// failed allocations not placed by a deployment are alerts of their own.
+func opsgenieAlias(n Notification) string {
+	if deployID := deploymentIDOf(n); deployID != "" {
+		return n.Subject.JobID + "/" + deployID
+	}
+	return n.Subject.JobID + "/" + n.Key
+}
+
+// opsgenieTags are the namespace and the job meta as "key:value", in the length limits of opsgenie.
+func opsgenieTags(s Subject) []string {
+	tags := []string{"nomad", "namespace:" + s.Namespace}
+	for _, k := range sortedKeys(s.JobMeta) {
+		if len(tags) == opsgenieTagsLimit {
+			break
+		}
+		tags = append(tags, truncate(k+":"+s.JobMeta[k], opsgenieTagLimit))
+	}
+	return tags
+}
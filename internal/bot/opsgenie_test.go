@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+// opsgenieStandIn records the alerts created and closed through the alert api.
+type opsgenieStandIn struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	requests []string
+	alerts   []opsgenieAlert
+}
+
+func (s *opsgenieStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "GenieKey key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"Could not authenticate"}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v2/alerts":
+		var alert opsgenieAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			s.t.Error(err)
+		}
+		s.alerts = append(s.alerts, alert)
+		s.requests = append(s.requests, "create "+alert.Alias)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/close"):
+		if r.URL.Query().Get("identifierType") != "alias" {
+			s.t.Errorf("close %s without identifierType=alias", r.URL.Path)
+		}
+		var c opsgenieClose
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			s.t.Error(err)
+		}
+		// the alias is path escaped, it contains a slash
+		alias := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), "/v2/alerts/"), "/close")
+		s.requests = append(s.requests, "close "+alias+": "+c.Note)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"not found"}`))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte(`{"result":"Request will be processed","requestId":"r1"}`))
+}
+
+func newTestOpsgenieBot(t *testing.T, apiKey string, s *opsgenieStandIn) *opsgenieBot {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	impls, err := newOpsgenieBot(Config{
+		Opsgenie: []OpsgenieConfig{{
+			Instance: Instance{Name: "og"}, APIKey: apiKey, APIURL: srv.URL + "/",
+			Priorities: map[string]string{KindAllocation: "P4"},
+		}},
+		Store: store.NewMemory(nil),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return impls[0].(*opsgenieBot)
+}
+
+func TestOpsgenieCreateClose(t *testing.T) {
+	s := &opsgenieStandIn{t: t}
+	b := newTestOpsgenieBot(t, "key", s)
+
+	failedAlloc := oomAllocation("a1")
+	failedAlloc.Severity = SeverityError
+	for _, n := range []Notification{
+		jobDeployment("d1", "running"),
+		jobDeployment("d1", "failed"),
+		failedAlloc,
+		jobDeployment("d2", "successful"),
+		// nothing left to close
+		jobDeployment("d3", "successful"),
+	} {
+		if _, err := b.Post(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	want := []string{
+		"create web/d1",
+		"create web/a1",
+		"close web%2Fd1: deployment d2 of web succeeded",
+		"close web%2Fa1: deployment d2 of web succeeded",
+	}
+	if strings.Join(s.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests\n%s\nwant\n%s", strings.Join(s.requests, "\n"), strings.Join(want, "\n"))
+	}
+
+	deploy, alloc := s.alerts[0], s.alerts[1]
+	if deploy.Priority != "P2" || deploy.Entity != "web" || deploy.Details["deployment_id"] != "d1" || deploy.Source != "nomad-event-notifier" {
+		t.Errorf("deployment alert = %+v", deploy)
+	}
+	if alloc.Priority != "P4" || alloc.Details["namespace"] != "prod" {
+		t.Errorf("allocation alert = %+v", alloc)
+	}
+	if strings.Join(deploy.Tags, ",") != "nomad,namespace:prod" {
+		t.Errorf("tags = %v", deploy.Tags)
+	}
+}
+
+func TestOpsgenieError(t *testing.T) {
+	s := &opsgenieStandIn{t: t}
+	b := newTestOpsgenieBot(t, "wrong", s)
+
+	_, err := b.Post(jobDeployment("d1", "failed"))
+	if err == nil || !strings.Contains(err.Error(), "Could not authenticate") {
+		t.Errorf("Post() error = %v, want the message of opsgenie", err)
+	}
+	if open, _ := b.incidents.open(Subject{Namespace: "prod", JobID: "web"}); len(open) != 0 {
+		t.Errorf("open alerts = %v, want none after a failed create", open)
+	}
+}
+
+func TestOpsgenieTags(t *testing.T) {
+	meta := map[string]string{"team": "payments", "long": strings.Repeat("x", 100)}
+	for i := 0; i < 30; i++ {
+		meta[strings.Repeat("k", i+1)] = "v"
+	}
+	tags := opsgenieTags(Subject{Namespace: "prod", JobMeta: meta})
+	if len(tags) != opsgenieTagsLimit {
+		t.Errorf("%d tags, want %d", len(tags), opsgenieTagsLimit)
+	}
+	for _, tag := range tags {
+		if len(tag) > opsgenieTagLimit {
+			t.Errorf("tag %q is longer than %d", tag, opsgenieTagLimit)
+		}
+	}
+}
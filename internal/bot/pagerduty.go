@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+)
+
+// pagerduty alerts are sent to the Events API v2, alerts with the same dedup key are one incident.
+// ref https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+
+const (
+	pagerdutyActionTrigger = "trigger"
+	pagerdutyActionResolve = "resolve"
+
+	// pagerdutySummaryLimit is the maximum length of the summary of an alert
+	pagerdutySummaryLimit = 1024
+)
+
+type pagerdutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerdutyPayload `json:"payload,omitempty"`
+	Client      string            `json:"client,omitempty"`
+	ClientURL   string            `json:"client_url,omitempty"`
+	Links       []pagerdutyLink   `json:"links,omitempty"`
+}
+
+type pagerdutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerdutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+type pagerdutyResponse struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Errors  []string `json:"errors"`
+}
+
+func newPagerDutyBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.PagerDuty) == 0 {
+		return nil, fmt.Errorf("please set pagerduty routing key to enable pagerduty bot: %w", errImplNotEnabled)
+	}
+
+	// alerts of deployments come from the nomad cluster
+	source := "nomad"
+	if u, err := url.Parse(nomadAddress); err == nil && u.Hostname() != "" {
+		source = u.Hostname()
+	}
+
+	var bots []Impl
+	for _, c := range cfg.PagerDuty {
+		if c.RoutingKey == "" {
+			return nil, fmt.Errorf("pagerduty %q: routing key is required", c.Name)
+		}
+		apiURL := c.APIURL
+		if apiURL == "" {
+			apiURL = "https://events.pagerduty.com"
+		}
+		bots = append(bots, &pagerdutyBot{
+			name:       c.Name,
+			routingKey: c.RoutingKey,
+			source:     source,
+			client:     resty.New().SetBaseURL(strings.TrimSuffix(apiURL, "/")),
+			incidents:  incidents{backend: c.Name, store: cfg.Store},
+			L:          slog.With("bot", "pagerduty", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+// pagerdutyBot triggers an alert for failed deployments and OOM killed allocations,
+// the alerts of a job are resolved once a later deployment of it succeeds.
+type pagerdutyBot struct {
+	mu         sync.Mutex
+	name       string
+	routingKey string
+	source     string
+	client     *resty.Client
+	incidents  incidents
+	L          *slog.Logger
+}
+
+func (b *pagerdutyBot) Name() string {
+	return b.name
+}
+
+func (b *pagerdutyBot) Type() string {
+	return "pagerduty"
+}
+
+func (b *pagerdutyBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case n.Kind == KindDeployment && n.Severity == SeveritySuccess:
+		return "", b.resolve(n)
+	case n.Kind == KindDeployment && n.Severity == SeverityError, n.Kind == KindAllocation && oomKilled(n):
+		return b.trigger(n)
+	default:
+		return "", nil
+	}
+}
+
+func (b *pagerdutyBot) trigger(n Notification) (string, error) {
+	dedupKey := pagerdutyDedupKey(n)
+	if err := b.send(b.event(n, dedupKey)); err != nil {
+		return "", fmt.Errorf("failed to trigger alert %s: %w", dedupKey, err)
+	}
+	b.L.Debug("triggered alert", "kind", n.Kind, "key", n.Key, "dedup_key", dedupKey)
+
+	if err := b.incidents.add(n.Subject, dedupKey); err != nil {
+		return "", err
+	}
+	return dedupKey, nil
+}
+
+// resolve resolves the alerts triggered for the job of the successful deployment n.
+func (b *pagerdutyBot) resolve(n Notification) error {
+	open, err := b.incidents.open(n.Subject)
+	if err != nil || len(open) == 0 {
+		return err
+	}
+
+	for i, dedupKey := range open {
+		err := b.send(pagerdutyEvent{RoutingKey: b.routingKey, EventAction: pagerdutyActionResolve, DedupKey: dedupKey})
+		if err != nil {
+			// keep the alerts not resolved yet for the next successful deployment
+			if serr := b.incidents.set(n.Subject, open[i:]); serr != nil {
+				b.L.Warn("error saving triggered alerts", "job_id", n.Subject.JobID, "error", serr)
+			}
+			return fmt.Errorf("failed to resolve alert %s: %w", dedupKey, err)
+		}
+		b.L.Debug("resolved alert", "kind", n.Kind, "key", n.Key, "dedup_key", dedupKey)
+	}
+	return b.incidents.set(n.Subject, nil)
+}
+
+// ref https://developer.pagerduty.com/api-reference/368ae3d938c9e-send-an-event-to-pager-duty
+func (b *pagerdutyBot) send(event pagerdutyEvent) error {
+	var r pagerdutyResponse
+	res, err := b.client.R().SetBody(event).SetResult(&r).SetError(&r).Post("/v2/enqueue")
+	if err != nil {
+		return err
+	}
+	if res.StatusCode() >= 300 {
+		if r.Message != "" {
+			return fmt.Errorf("%s %v, code=%v", r.Message, r.Errors, res.StatusCode())
+		}
+		return fmt.Errorf("%s, code=%v", res.Body(), res.StatusCode())
+	}
+	return nil
+}
+
+func (b *pagerdutyBot) event(n Notification, dedupKey string) pagerdutyEvent {
+	summary := n.Title
+	if n.Summary != "" {
+		summary += ": " + n.Summary
+	}
+
+	payload := &pagerdutyPayload{
+		Summary:   truncate(summary, pagerdutySummaryLimit),
+		Source:    b.source,
+		Severity:  pagerdutySeverity(n),
+		Component: n.Subject.JobID,
+		Group:     strings.Join(n.Subject.TaskGroups, ","),
+		Class:     n.Kind,
+		CustomDetails: map[string]string{
+			"namespace": n.Subject.Namespace,
+		},
+	}
+	for _, f := range n.Fields {
+		payload.CustomDetails[f.Title] = f.Value
+	}
+	if n.data != nil && n.data.Allocation != nil {
+		// the node of the allocation is the affected system
+		if n.data.Allocation.NodeName != "" {
+			payload.Source = n.data.Allocation.NodeName
+		}
+		payload.Class = string(classify.OOMKilled)
+	}
+
+	event := pagerdutyEvent{
+		RoutingKey:  b.routingKey,
+		EventAction: pagerdutyActionTrigger,
+		DedupKey:    dedupKey,
+		Payload:     payload,
+		Client:      "nomad-event-notifier",
+		ClientURL:   n.URL,
+	}
+	if n.URL != "" {
+		event.Links = append(event.Links, pagerdutyLink{Href: n.URL, Text: "Open in Nomad"})
+	}
+	for _, l := range n.Links {
+		event.Links = append(event.Links, pagerdutyLink{Href: l.URL, Text: l.Title})
+	}
+	return event
+}
+
+// pagerdutySeverity is critical for failed deployments, error for failed allocations
+// and warning for allocations still running after being OOM killed.
+func pagerdutySeverity(n Notification) string {
+	switch {
+	case n.Kind == KindDeployment && n.Severity == SeverityError:
+		return "critical"
+	case n.Severity == SeverityError:
+		return "error"
+	default:
+		return "warning"
+	}
+}
+
+// pagerdutyDedupKey makes the alerts about one deployment a single incident,
+// OOM killed allocations not placed by a deployment are alerts of their own.
+func pagerdutyDedupKey(n Notification) string {
+	if deployID := deploymentIDOf(n); deployID != "" {
+		return "nomad/deployment/" + deployID
+	}
+	if n.data != nil && n.data.Allocation != nil {
+		return "nomad/allocation/" + n.data.Allocation.ID
+	}
+	return "nomad/" + n.Kind + "/" + n.Key
+}
+
+// oomKilled reports whether a task of the allocation of n was OOM killed.
+func oomKilled(n Notification) bool {
+	if n.data == nil {
+		return false
+	}
+	for _, task := range n.data.Tasks {
+		for _, f := range task.Findings {
+			if f.Kind == classify.OOMKilled {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+func jobDeployment(id, status string) Notification {
+	n := deploymentNotification(api.Deployment{ID: id, JobID: "web", Namespace: "prod", Status: status}, nil, "http://nomad:4646")
+	n.Title = "web deployment " + status
+	return n
+}
+
+func oomAllocation(id string) Notification {
+	alloc := api.Allocation{
+		ID: id, JobID: "web", Namespace: "prod", TaskGroup: "web", NodeName: "node-1", ClientStatus: "failed",
+		TaskStates: map[string]*api.TaskState{"server": {State: "dead", Failed: true}},
+	}
+	n := allocationNotification(alloc, []classify.Finding{{Kind: classify.OOMKilled, Task: "server", Message: "OOM Killed"}}, "http://nomad:4646")
+	n.Title = id + " allocation update"
+	return n
+}
+
+// pagerdutyStandIn records the events sent to the Events API v2, failing the ones failFor returns true for.
+type pagerdutyStandIn struct {
+	mu      sync.Mutex
+	events  []pagerdutyEvent
+	failFor func(e pagerdutyEvent) bool
+}
+
+func (s *pagerdutyStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var e pagerdutyEvent
+	if r.URL.Path != "/v2/enqueue" || json.NewDecoder(r.Body).Decode(&e) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failFor != nil && s.failFor(e) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"status":"unavailable","message":"try again"}`))
+		return
+	}
+	s.events = append(s.events, e)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte(`{"status":"success","message":"Event processed"}`))
+}
+
+// sent returns the actions and dedup keys of the events sent so far, e.g. "trigger nomad/deployment/d1".
+func (s *pagerdutyStandIn) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sent []string
+	for _, e := range s.events {
+		sent = append(sent, e.EventAction+" "+e.DedupKey)
+	}
+	return sent
+}
+
+func newTestPagerDutyBot(t *testing.T, s *pagerdutyStandIn) *pagerdutyBot {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	impls, err := newPagerDutyBot(Config{
+		PagerDuty: []PagerDutyConfig{{Instance: Instance{Name: "pd"}, RoutingKey: "rk", APIURL: srv.URL}},
+		Store:     store.NewMemory(nil),
+	}, "http://nomad.example.com:4646")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return impls[0].(*pagerdutyBot)
+}
+
+func TestPagerDutyTriggerResolve(t *testing.T) {
+	s := &pagerdutyStandIn{}
+	b := newTestPagerDutyBot(t, s)
+
+	for _, n := range []Notification{
+		jobDeployment("d1", "running"),
+		jobDeployment("d1", "failed"),
+		oomAllocation("a1"),
+		// the second failure event of the deployment is the same incident
+		jobDeployment("d1", "failed"),
+		jobDeployment("d2", "successful"),
+		// nothing left to resolve
+		jobDeployment("d3", "successful"),
+	} {
+		if _, err := b.Post(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"trigger nomad/deployment/d1",
+		"trigger nomad/allocation/a1",
+		"trigger nomad/deployment/d1",
+		"resolve nomad/deployment/d1",
+		"resolve nomad/allocation/a1",
+	}
+	if got := s.sent(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	trigger := s.events[0]
+	if trigger.RoutingKey != "rk" || trigger.Payload.Severity != "critical" || trigger.Payload.Source != "nomad.example.com" ||
+		trigger.Payload.Component != "web" || trigger.Payload.CustomDetails["namespace"] != "prod" {
+		t.Errorf("trigger event = %+v, payload = %+v", trigger, trigger.Payload)
+	}
+	oom := s.events[1].Payload
+	if oom.Source != "node-1" || oom.Class != string(classify.OOMKilled) || oom.Severity != "error" {
+		t.Errorf("oom payload = %+v", oom)
+	}
+	if s.events[3].Payload != nil {
+		t.Errorf("resolve event has a payload: %+v", s.events[3].Payload)
+	}
+}
+
+func TestPagerDutyResolveFailureKeepsOpen(t *testing.T) {
+	failing := true
+	s := &pagerdutyStandIn{failFor: func(e pagerdutyEvent) bool {
+		return failing && e.EventAction == pagerdutyActionResolve && e.DedupKey == "nomad/allocation/a1"
+	}}
+	b := newTestPagerDutyBot(t, s)
+
+	for _, n := range []Notification{jobDeployment("d1", "failed"), oomAllocation("a1")} {
+		if _, err := b.Post(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := b.Post(jobDeployment("d2", "successful")); err == nil {
+		t.Fatal("Post() succeeded although resolving failed")
+	}
+	open, err := b.incidents.open(Subject{Namespace: "prod", JobID: "web"})
+	if err != nil || strings.Join(open, " ") != "nomad/allocation/a1" {
+		t.Errorf("open alerts = %v, %v, want the one not resolved", open, err)
+	}
+
+	// the next successful deployment resolves the rest
+	s.mu.Lock()
+	failing = false
+	s.mu.Unlock()
+	if _, err := b.Post(jobDeployment("d3", "successful")); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.sent(); got[len(got)-1] != "resolve nomad/allocation/a1" {
+		t.Errorf("sent %v", got)
+	}
+	if open, _ := b.incidents.open(Subject{Namespace: "prod", JobID: "web"}); len(open) != 0 {
+		t.Errorf("open alerts = %v, want none", open)
+	}
+}
+
+func TestPagerDutySummaryTruncated(t *testing.T) {
+	b := &pagerdutyBot{routingKey: "rk", source: "nomad"}
+	n := jobDeployment("d1", "failed")
+	n.Summary = strings.Repeat("ä", pagerdutySummaryLimit)
+
+	summary := b.event(n, "nomad/deployment/d1").Payload.Summary
+	if len(summary) > pagerdutySummaryLimit || !utf8.ValidString(summary) || !strings.HasSuffix(summary, "...") {
+		t.Errorf("summary is %d bytes, valid UTF-8 %v", len(summary), utf8.ValidString(summary))
+	}
+}
@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-bexpr"
+	"github.com/hashicorp/nomad/api"
+)
+
+// Subject is what a notification is about, routes match on it.
+// Fields not known for a kind of notification are empty, e.g. the job ID of a node.
+type Subject struct {
+	Namespace  string
+	JobID      string
+	TaskGroups []string
+	NodePool   string
+	JobMeta    map[string]string
+	// Payload is the decoded event, e.g. the api.Deployment, route filters are evaluated on it
+	Payload any
+}
+
+// jobSubject is the subject of a notification about the job jobID, job may be nil if unknown.
+func jobSubject(namespace, jobID string, job *api.Job) Subject {
+	s := Subject{Namespace: namespace, JobID: jobID}
+	if job != nil {
+		s.NodePool = stringValue(job.NodePool)
+		s.JobMeta = job.Meta
+	}
+	return s
+}
+
+// Route sends the notifications matching all of its conditions to Targets.
+// Conditions are lists of globs where "*" matches any characters, an empty list matches anything.
+type Route struct {
+	Name       string
+	Namespaces []string
+	JobIDs     []string
+	TaskGroups []string
+	NodePools  []string
+	// Meta maps job meta keys to globs their value has to match
+	Meta map[string]string
+	// Filter is a go-bexpr expression evaluated on the payload, e.g. `Namespace == "prod"`.
+	// Payloads without a field of the expression do not match.
+	Filter string
+
+	// Targets are backend instance names, a route without targets drops the notifications it matches
+	Targets []string
+	// Continue evaluates the following routes after this one matched
+	Continue bool
+}
+
+type compiledRoute struct {
+	Route
+	namespaces, jobIDs, taskGroups, nodePools []*regexp.Regexp
+	meta                                      map[string]*regexp.Regexp
+	filter                                    *bexpr.Evaluator
+}
+
+// router selects the backend instances of a notification.
+type router struct {
+	routes []compiledRoute
+	// defaults are the targets of notifications matching no route, nil for all instances
+	defaults []string
+}
+
+func newRouter(routes []Route, defaults []string, instances map[string]Instance) (*router, error) {
+	checkTargets := func(name string, targets []string) error {
+		for _, t := range targets {
+			if _, ok := instances[t]; !ok {
+				return fmt.Errorf("route %q: unknown target %q", name, t)
+			}
+		}
+		return nil
+	}
+
+	r := &router{defaults: defaults}
+	if err := checkTargets("default", defaults); err != nil {
+		return nil, err
+	}
+	for _, route := range routes {
+		if err := checkTargets(route.Name, route.Targets); err != nil {
+			return nil, err
+		}
+		c, err := compileRoute(route)
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, c)
+	}
+	return r, nil
+}
+
+// compileRoute compiles the conditions of route, its targets are not checked.
+func compileRoute(route Route) (compiledRoute, error) {
+	c := compiledRoute{
+		Route:      route,
+		namespaces: compileGlobs(route.Namespaces),
+		jobIDs:     compileGlobs(route.JobIDs),
+		taskGroups: compileGlobs(route.TaskGroups),
+		nodePools:  compileGlobs(route.NodePools),
+		meta:       make(map[string]*regexp.Regexp),
+	}
+	for k, v := range route.Meta {
+		c.meta[k] = compileGlob(v)
+	}
+	if route.Filter != "" {
+		filter, err := bexpr.CreateEvaluator(route.Filter)
+		if err != nil {
+			return c, fmt.Errorf("route %q: invalid filter: %w", route.Name, err)
+		}
+		c.filter = filter
+	}
+	return c, nil
+}
+
+// targets returns the instance names to send n to, nil for all instances.
+func (r *router) targets(n Notification) map[string]bool {
+	var targets map[string]bool
+	for _, route := range r.routes {
+		if !route.matches(n.Subject) {
+			continue
+		}
+		if targets == nil {
+			targets = make(map[string]bool)
+		}
+		for _, t := range route.Targets {
+			targets[t] = true
+		}
+		if !route.Continue {
+			break
+		}
+	}
+	if targets != nil || r.defaults == nil {
+		return targets
+	}
+
+	targets = make(map[string]bool)
+	for _, t := range r.defaults {
+		targets[t] = true
+	}
+	return targets
+}
+
+func (r compiledRoute) matches(s Subject) bool {
+	if !matchAny(r.namespaces, s.Namespace) || !matchAny(r.jobIDs, s.JobID) || !matchAny(r.nodePools, s.NodePool) {
+		return false
+	}
+	if len(r.taskGroups) > 0 {
+		found := false
+		for _, tg := range s.TaskGroups {
+			if matchAny(r.taskGroups, tg) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, glob := range r.meta {
+		v, ok := s.JobMeta[k]
+		if !ok || !glob.MatchString(v) {
+			return false
+		}
+	}
+	if r.filter != nil {
+		if s.Payload == nil {
+			return false
+		}
+		// evaluating fails for payloads without the fields of the expression, e.g. JobID of a node
+		ok, err := r.filter.Evaluate(s.Payload)
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(globs []*regexp.Regexp, s string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, g := range globs {
+		if g.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileGlobs(globs []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, g := range globs {
+		res = append(res, compileGlob(g))
+	}
+	return res
+}
+
+// compileGlob matches "*" to any characters including "/", unlike path.Match,
+// so "batch-*" matches the dispatched "batch-x/dispatch-1234".
+func compileGlob(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestCompileGlob(t *testing.T) {
+	cases := []struct {
+		glob, s string
+		want    bool
+	}{
+		{"web", "web", true},
+		{"web", "web-api", false},
+		{"web*", "web-api", true},
+		{"*-api", "web-api", true},
+		{"*", "", true},
+		{"batch-*", "batch-x/dispatch-1234", true},
+		{"a.b", "axb", false},
+		{"prod-(eu)", "prod-(eu)", true},
+	}
+	for _, c := range cases {
+		if got := compileGlob(c.glob).MatchString(c.s); got != c.want {
+			t.Errorf("glob %q matching %q = %v, want %v", c.glob, c.s, got, c.want)
+		}
+	}
+}
+
+func TestRouterTargets(t *testing.T) {
+	instances := map[string]Instance{"ops": {}, "team-a": {}, "team-b": {}, "audit": {}}
+	routes := []Route{
+		{Name: "audit", Namespaces: []string{"prod"}, Targets: []string{"audit"}, Continue: true},
+		{Name: "team-a", JobIDs: []string{"a-*"}, Meta: map[string]string{"team": "a"}, Targets: []string{"team-a"}},
+		{Name: "workers", TaskGroups: []string{"worker*"}, Targets: []string{"team-b"}},
+		{Name: "drop", NodePools: []string{"scratch"}},
+	}
+	r, err := newRouter(routes, []string{"ops"}, instances)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		subject Subject
+		want    []string
+	}{
+		{
+			name:    "default",
+			subject: Subject{Namespace: "dev", JobID: "web"},
+			want:    []string{"ops"},
+		},
+		{
+			name:    "continue to the next route",
+			subject: Subject{Namespace: "prod", JobID: "a-web", JobMeta: map[string]string{"team": "a"}},
+			want:    []string{"audit", "team-a"},
+		},
+		{
+			name:    "continue to the default",
+			subject: Subject{Namespace: "prod", JobID: "web"},
+			want:    []string{"audit"},
+		},
+		{
+			name:    "meta mismatch",
+			subject: Subject{Namespace: "dev", JobID: "a-web", JobMeta: map[string]string{"team": "b"}},
+			want:    []string{"ops"},
+		},
+		{
+			name:    "any task group",
+			subject: Subject{Namespace: "dev", JobID: "web", TaskGroups: []string{"api", "worker-1"}},
+			want:    []string{"team-b"},
+		},
+		{
+			name:    "route without targets drops",
+			subject: Subject{Namespace: "dev", NodePool: "scratch"},
+			want:    []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := sortedKeys(r.targets(Notification{Subject: c.subject}))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("targets = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRouterAllInstances(t *testing.T) {
+	r, err := newRouter([]Route{{Name: "prod", Namespaces: []string{"prod"}, Targets: []string{"ops"}}}, nil, map[string]Instance{"ops": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.targets(Notification{Subject: Subject{Namespace: "dev"}}); got != nil {
+		t.Errorf("targets = %v, want nil for all instances", got)
+	}
+}
+
+func TestNewRouterUnknownTarget(t *testing.T) {
+	instances := map[string]Instance{"ops": {}}
+	if _, err := newRouter([]Route{{Name: "r", Targets: []string{"nope"}}}, nil, instances); err == nil {
+		t.Error("unknown route target accepted")
+	}
+	if _, err := newRouter(nil, []string{"nope"}, instances); err == nil {
+		t.Error("unknown default target accepted")
+	}
+}
+
+func TestRouteFilter(t *testing.T) {
+	route, err := compileRoute(Route{Name: "failed", Filter: `Status == "failed" and Namespace == "prod"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		payload any
+		want    bool
+	}{
+		{name: "match", payload: api.Deployment{Namespace: "prod", Status: "failed"}, want: true},
+		{name: "pointer", payload: &api.Deployment{Namespace: "prod", Status: "failed"}, want: true},
+		{name: "mismatch", payload: api.Deployment{Namespace: "prod", Status: "running"}, want: false},
+		{name: "no payload", payload: nil, want: false},
+		// nodes have no namespace, evaluating the expression fails
+		{name: "missing field", payload: api.Node{Status: "failed"}, want: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := route.matches(Subject{Payload: c.payload}); got != c.want {
+				t.Errorf("matches = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRouteFilterInvalid(t *testing.T) {
+	if _, err := compileRoute(Route{Name: "broken", Filter: `Status ==`}); err == nil {
+		t.Error("invalid filter accepted")
+	}
+}
@@ -11,23 +11,26 @@ import (
 	"time"
 
 	"github.com/hashicorp/nomad/api"
-	"github.com/hashicorp/nomad/nomad/structs"
 	"github.com/slack-go/slack"
-	"github.com/ttys3/nomad-event-notifier/version"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
 )
 
 type slackBot struct {
 	mu           sync.Mutex
+	name         string
 	chanID       string
 	nomadAddress string
 	api          *slack.Client
-	deploys      map[string]string
-	allocations  map[string]string
+	store        store.MessageStore
+	nomad        *api.Client
+	secret       string
+	cfg          Config
 	L            *slog.Logger
 }
 
-func newSlackBot(cfg Config, nomadAddress string) (Impl, error) {
-	if cfg.Token == "" || cfg.Channel == "" {
+func newSlackBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Slack) == 0 {
 		return nil, fmt.Errorf("please set clash token and channel to enable slack bot: %w", errImplNotEnabled)
 	}
 
@@ -36,106 +39,64 @@ func newSlackBot(cfg Config, nomadAddress string) (Impl, error) {
 	customTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	httpClient := &http.Client{Transport: customTransport}
 
-	api := slack.New(cfg.Token, slack.OptionHTTPClient(httpClient))
+	var bots []Impl
+	for _, c := range cfg.Slack {
+		if c.Token == "" || c.Channel == "" {
+			return nil, fmt.Errorf("slack %q: token and channel are required", c.Name)
+		}
+		bots = append(bots, &slackBot{
+			name:         c.Name,
+			api:          slack.New(c.Token, slack.OptionHTTPClient(httpClient)),
+			nomadAddress: nomadAddress,
+			chanID:       c.Channel,
+			store:        cfg.Store,
+			nomad:        cfg.Nomad,
+			secret:       c.SigningSecret,
+			cfg:          cfg,
+			L:            slog.With("bot", "slack", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
 
-	bot := &slackBot{
-		api:          api,
-		nomadAddress: nomadAddress,
-		chanID:       cfg.Channel,
-		deploys:      make(map[string]string),
-		allocations:  make(map[string]string),
-		L:            slog.With("bot", "slack"),
-	}
+func (b *slackBot) Name() string {
+	return b.name
+}
 
-	return bot, nil
+func (b *slackBot) Type() string {
+	return "slack"
 }
 
-func (b *slackBot) UpsertDeployMsg(deploy api.Deployment) error {
+func (b *slackBot) Post(n Notification) (string, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	ts, ok := b.deploys[deploy.ID]
-	if !ok {
-		return b.initialDeployMsg(deploy)
-	}
-	b.L.Debug("Existing deployment found, updating status", "slack ts", ts)
-
-	attachments := b.DefaultAttachmentsDeployment(deploy)
-	opts := []slack.MsgOption{slack.MsgOptionAttachments(attachments...)}
-	opts = append(opts, DefaultDeployMsgOpts()...)
-
-	_, ts, _, err := b.api.UpdateMessage(b.chanID, ts, opts...)
-	if err != nil {
-		return err
-	}
-	b.deploys[deploy.ID] = ts
-
-	return nil
-}
-
-func (b *slackBot) initialDeployMsg(deploy api.Deployment) error {
-	attachments := b.DefaultAttachmentsDeployment(deploy)
-
-	opts := []slack.MsgOption{slack.MsgOptionAttachments(attachments...)}
+	opts := []slack.MsgOption{slack.MsgOptionAttachments(b.attachments(n)...)}
 	opts = append(opts, DefaultDeployMsgOpts()...)
 
 	_, ts, err := b.api.PostMessage(b.chanID, opts...)
 	if err != nil {
-		return fmt.Errorf("post message failed,  err=%w", err)
+		return "", fmt.Errorf("post message failed,  err=%w", err)
 	}
-	b.deploys[deploy.ID] = ts
-	return nil
+	return ts, nil
 }
 
-func (b *slackBot) UpsertAllocationMsg(alloc api.Allocation) error {
-	// do not report old OOM
-	if time.Now().Unix()-alloc.ModifyTime > 300 {
-		return nil
-	}
-	// only report last alloc OOM
-	if alloc.NextAllocation != "" {
-		return nil
-	}
+func (b *slackBot) Update(ts string, n Notification) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	ts, ok := b.allocations[alloc.ID]
-	if !ok {
-		return b.initialAllocMsg(alloc)
-	}
-	b.L.Debug("Existing allocation found, updating status", "slack ts", ts)
-
-	attachments := b.DefaultAttachmentsAlloc(alloc)
-	if len(attachments) == 0 {
-		return nil
-	}
-
-	opts := []slack.MsgOption{slack.MsgOptionAttachments(attachments...)}
-	opts = append(opts, DefaultDeployMsgOpts()...)
-
-	_, ts, _, err := b.api.UpdateMessage(b.chanID, ts, opts...)
-	if err != nil {
-		return err
-	}
-	b.allocations[alloc.ID] = ts
-
-	return nil
+	return b.update(b.chanID, ts, n)
 }
 
-func (b *slackBot) initialAllocMsg(alloc api.Allocation) error {
-	attachments := b.DefaultAttachmentsAlloc(alloc)
-	if len(attachments) == 0 {
-		return nil
-	}
-
-	opts := []slack.MsgOption{slack.MsgOptionAttachments(attachments...)}
+// update must be called with mu held.
+func (b *slackBot) update(chanID, ts string, n Notification) error {
+	opts := []slack.MsgOption{slack.MsgOptionAttachments(b.attachments(n)...)}
 	opts = append(opts, DefaultDeployMsgOpts()...)
 
-	_, ts, err := b.api.PostMessage(b.chanID, opts...)
-	if err != nil {
-		return fmt.Errorf("post message failed,  err=%w", err)
+	if _, _, _, err := b.api.UpdateMessage(chanID, ts, opts...); err != nil {
+		return fmt.Errorf("update message failed, ts=%s, err=%w", ts, err)
 	}
-	b.deploys[alloc.ID] = ts
 	return nil
 }
 
@@ -145,121 +106,85 @@ func DefaultDeployMsgOpts() []slack.MsgOption {
 	}
 }
 
-func (b *slackBot) DefaultAttachmentsDeployment(deploy api.Deployment) []slack.Attachment {
-	var actions []slack.AttachmentAction
-	if deploy.StatusDescription == "Deployment is running but requires manual promotion" {
-		actions = []slack.AttachmentAction{
-			{
-				Name: "promote",
-				Text: "Promote :heavy_check_mark:",
-				Type: "button",
-			},
-			{
-				Name:  "fail",
-				Text:  "Fail :boom:",
-				Style: "danger",
-				Type:  "button",
-				Confirm: &slack.ConfirmationField{
-					Title:       "Are you sure?",
-					Text:        ":nomad-sad: :nomad-sad: :nomad-sad: :nomad-sad: :nomad-sad:",
-					OkText:      "Fail",
-					DismissText: "Woops!",
-				},
-			},
+func (b *slackBot) attachments(n Notification) []slack.Attachment {
+	attachment := slackAttachment(n, slackLink)
+	if n.Kind == KindDeployment {
+		if note := b.actionNote(n.Key); note != "" {
+			attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Action", Value: note})
 		}
 	}
-	var fields []slack.AttachmentField
-	for tgn, tg := range deploy.TaskGroups {
-		field := slack.AttachmentField{
-			Title: fmt.Sprintf("Task Group: %s", tgn),
-			Value: fmt.Sprintf("Desired: %d, Placed: %d, Healthy: %d, Unhealthy: %d, DesiredCanaries: %d, PlacedCanaries: %+v",
-				tg.DesiredTotal, tg.PlacedAllocs, tg.HealthyAllocs, tg.UnhealthyAllocs, tg.DesiredCanaries, tg.PlacedCanaries),
+
+	for _, a := range n.Actions {
+		action := slack.AttachmentAction{
+			Name:  a.Name,
+			Text:  a.Text,
+			Style: a.Style,
+			Type:  "button",
+			Value: a.Value,
 		}
-		fields = append(fields, field)
+		if a.Confirm != nil {
+			action.Confirm = &slack.ConfirmationField{
+				Title:       a.Confirm.Title,
+				Text:        a.Confirm.Text,
+				OkText:      a.Confirm.OkText,
+				DismissText: a.Confirm.DismissText,
+			}
+		}
+		attachment.Actions = append(attachment.Actions, action)
 	}
-	return []slack.Attachment{
-		{
-			Fallback:   "deployment update",
-			Color:      slackColorForStatus(deploy.Status),
-			AuthorName: fmt.Sprintf("%s deployment update", deploy.JobID),
-			AuthorLink: fmt.Sprintf("%s/ui/jobs/%s/deployments", b.nomadAddress, deploy.JobID),
-			Title:      deploy.StatusDescription,
-			TitleLink:  fmt.Sprintf("%s/ui/jobs/%s/deployments", b.nomadAddress, deploy.JobID),
-			Fields:     fields,
-			Footer:     fmt.Sprintf("nomad-event-notifier: %s | Deploy ID: %s", version.Version, deploy.ID),
-			Ts:         json.Number(fmt.Sprintf("%d", time.Now().Unix())),
-			Actions:    actions,
-		},
+	if n.Kind == KindDeployment && len(attachment.Actions) > 0 {
+		attachment.CallbackID = deploymentCallbackID
 	}
+
+	return []slack.Attachment{attachment}
 }
 
-func (b *slackBot) DefaultAttachmentsAlloc(alloc api.Allocation) []slack.Attachment {
-	var actions []slack.AttachmentAction
+// slackAttachment renders n without actions as a slack attachment, the format mattermost understands too.
+// link formats the links of n, their markup differs between slack and mattermost.
+func slackAttachment(n Notification, link func(Link) string) slack.Attachment {
 	var fields []slack.AttachmentField
-	for taskName, taskState := range alloc.TaskStates {
-		field := slack.AttachmentField{
-			Title: fmt.Sprintf("taskState:%s Failed: %v, Restarts: %d Task Group: %s Task: %s",
-				taskState.State, taskState.Failed, taskState.Restarts, alloc.TaskGroup, taskName),
-			Value: "",
-		}
-		gotOOM := false
-		value := "---------------------------------------------\n"
-		for _, event := range taskState.Events {
-			if strings.Contains(event.DisplayMessage, "OOM") {
-				gotOOM = true
-			}
-
-			value += fmt.Sprintf("*%s*: %s %s", event.Type, event.DisplayMessage, event.Details["driver_message"])
-			if event.Type == structs.TaskTerminated {
-				for _, key := range []string{"exit_code", "signal"} {
-					if val, ok := event.Details[key]; ok && val != "" {
-						value += fmt.Sprintf(", %s: %s", key, val)
-					}
-				}
-			}
-			if event.Type == structs.TaskKilled {
-				for _, key := range []string{"kill_reason", "kill_error", "kill_timeout"} {
-					if val, ok := event.Details[key]; ok && val != "" {
-						value += fmt.Sprintf(", %s: %s", key, val)
-					}
-				}
-			}
-			value += "\n"
-		}
-		field.Value = value
-		if !gotOOM {
-			continue
+	for _, f := range n.Fields {
+		fields = append(fields, slack.AttachmentField{Title: f.Title, Value: f.Value, Short: f.Short})
+	}
+	if len(n.Links) > 0 {
+		var links []string
+		for _, l := range n.Links {
+			links = append(links, link(l))
 		}
-		fields = append(fields, field)
+		fields = append(fields, slack.AttachmentField{Title: "Links", Value: strings.Join(links, "\n")})
 	}
 
-	if len(fields) == 0 {
-		return []slack.Attachment{}
+	attachment := slack.Attachment{
+		Fallback:  n.Title,
+		Color:     slackColorForSeverity(n.Severity),
+		Title:     n.Title,
+		TitleLink: n.URL,
+		Fields:    fields,
+		Footer:    n.Footer,
+		Ts:        json.Number(fmt.Sprintf("%d", time.Now().Unix())),
 	}
-	return []slack.Attachment{
-		{
-			Fallback:   "allocation update",
-			Color:      slackColorForStatus(alloc.ClientStatus),
-			AuthorName: fmt.Sprintf("%s allocation update", alloc.ID),
-			AuthorLink: fmt.Sprintf("%s/ui/allocations/%s", b.nomadAddress, alloc.ID),
-			Title:      alloc.ClientDescription,
-			TitleLink:  fmt.Sprintf("%s/ui/jobs/%s/%s", b.nomadAddress, alloc.JobID, alloc.TaskGroup),
-			Fields:     fields,
-			Footer:     fmt.Sprintf("Allocation ID: %s", alloc.ID),
-			Ts:         json.Number(fmt.Sprintf("%d", time.Now().Unix())),
-			Actions:    actions,
-		},
+	if n.Summary != "" {
+		attachment.AuthorName = n.Title
+		attachment.AuthorLink = n.URL
+		attachment.Title = n.Summary
 	}
+	return attachment
+}
+
+func slackLink(l Link) string {
+	return fmt.Sprintf("<%s|%s>", l.URL, l.Title)
 }
 
-func slackColorForStatus(status string) string {
-	switch status {
-	case "failed":
+func slackColorForSeverity(severity Severity) string {
+	switch severity {
+	case SeverityError:
 		return "#dd4e58"
-	case "running":
+	case SeverityInfo:
 		return "#1daeff"
-	case "successful":
+	case SeveritySuccess:
 		return "#36a64f"
+	case SeverityWarning:
+		return "#f2c744"
 	default:
 		return "#D3D3D3"
 	}
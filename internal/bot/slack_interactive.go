@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/slack-go/slack"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+const (
+	deploymentCallbackID = "deployment"
+
+	actionPromote = "promote"
+	actionFail    = "fail"
+
+	// kindAction keeps who acted on a deployment message, so later updates still show it
+	kindAction = "action"
+)
+
+// deploymentActionValue encodes the deployment of a button as "<namespace>/<id>",
+// namespaces can not contain a slash.
+func deploymentActionValue(deploy api.Deployment) string {
+	return deploy.Namespace + "/" + deploy.ID
+}
+
+func parseDeploymentActionValue(value string) (namespace, id string, err error) {
+	namespace, id, ok := strings.Cut(value, "/")
+	if !ok || id == "" {
+		return "", "", fmt.Errorf("invalid deployment action value %q", value)
+	}
+	return namespace, id, nil
+}
+
+func (b *slackBot) RegisterHandlers(mux *http.ServeMux) {
+	if b.secret == "" || b.nomad == nil {
+		b.L.Info("slack signing secret not set, Promote / Fail buttons are disabled")
+		return
+	}
+	path := b.interactivePath()
+	mux.HandleFunc("POST "+path, b.handleInteraction)
+	b.L.Info("slack interactivity request URL registered", "path", path)
+}
+
+// interactivePath is the interactivity request URL path of the instance,
+// "/slack/interactive" for the instance named "slack", "/slack/<name>/interactive" otherwise.
+func (b *slackBot) interactivePath() string {
+	if b.name == "slack" {
+		return "/slack/interactive"
+	}
+	return "/slack/" + url.PathEscape(b.name) + "/interactive"
+}
+
+// handleInteraction handles the button clicks slack posts to the interactivity request URL.
+// https://api.slack.com/legacy/interactive-messages
+func (b *slackBot) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+
+	// https://api.slack.com/authentication/verifying-requests-from-slack
+	sv, err := slack.NewSecretsVerifier(r.Header, b.secret)
+	if err != nil {
+		b.L.Warn("invalid slack interaction request", "error", err)
+		http.Error(w, "invalid request", http.StatusUnauthorized)
+		return
+	}
+	if _, err := sv.Write(body); err != nil {
+		http.Error(w, "invalid request", http.StatusInternalServerError)
+		return
+	}
+	if err := sv.Ensure(); err != nil {
+		b.L.Warn("slack interaction signature mismatch", "error", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	var cb slack.InteractionCallback
+	if err := json.Unmarshal([]byte(form.Get("payload")), &cb); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if cb.CallbackID != deploymentCallbackID || len(cb.ActionCallback.AttachmentActions) == 0 {
+		b.L.Warn("unknown slack interaction", "callback_id", cb.CallbackID, "type", cb.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// slack shows the user an error unless we respond within 3 seconds,
+	// acting on nomad and updating the message may take longer
+	w.WriteHeader(http.StatusOK)
+
+	action := cb.ActionCallback.AttachmentActions[0]
+	go func() {
+		if err := b.deploymentAction(cb, action.Name, action.Value); err != nil {
+			b.L.Error("error handling slack interaction", "action", action.Name, "value", action.Value, "error", err)
+		}
+	}()
+}
+
+// deploymentAction promotes or fails the deployment and updates the message
+// the button was clicked on with who did it and the result.
+func (b *slackBot) deploymentAction(cb slack.InteractionCallback, name, value string) error {
+	namespace, id, err := parseDeploymentActionValue(value)
+	if err != nil {
+		return err
+	}
+
+	b.L.Info("slack deployment action", "action", name, "deploy_id", id, "namespace", namespace,
+		"user", cb.User.Name, "user_id", cb.User.ID)
+
+	wo := &api.WriteOptions{Namespace: namespace}
+	switch name {
+	case actionPromote:
+		_, _, err = b.nomad.Deployments().PromoteAll(id, wo)
+	case actionFail:
+		_, _, err = b.nomad.Deployments().Fail(id, wo)
+	default:
+		return fmt.Errorf("unknown action %q", name)
+	}
+
+	result := "ok"
+	if err != nil {
+		result = fmt.Sprintf("error: %s", err)
+	}
+	note := fmt.Sprintf("%s by <@%s>: %s", name, cb.User.ID, result)
+
+	deploy, _, infoErr := b.nomad.Deployments().Info(id, &api.QueryOptions{Namespace: namespace})
+	if infoErr != nil {
+		return errors.Join(err, fmt.Errorf("error reading deployment: %w", infoErr))
+	}
+
+	// the message is still updated without the job, only its meta is missing in templates
+	job, _, jobErr := b.nomad.Jobs().Info(deploy.JobID, &api.QueryOptions{Namespace: namespace})
+	if jobErr != nil {
+		b.L.Warn("error reading job", "job_id", deploy.JobID, "namespace", namespace, "error", jobErr)
+		job = nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	noteKey := store.Key{Backend: b.name, Kind: kindAction, ID: id}
+	if setErr := b.store.Set(noteKey, note, b.cfg.deployTTL(*deploy)); setErr != nil {
+		return errors.Join(err, setErr)
+	}
+
+	n := deploymentNotification(*deploy, job, b.nomadAddress)
+	if tmplErr := b.cfg.Templates.apply(b.Type(), &n); tmplErr != nil {
+		return errors.Join(err, tmplErr)
+	}
+	if updateErr := b.update(cb.Channel.ID, cb.MessageTs, n); updateErr != nil {
+		return errors.Join(err, updateErr)
+	}
+
+	return err
+}
+
+// actionNote returns who acted on the deployment message and the result, if anyone did.
+func (b *slackBot) actionNote(deployID string) string {
+	note, _, err := b.store.Get(store.Key{Backend: b.name, Kind: kindAction, ID: deployID})
+	if err != nil {
+		b.L.Warn("error reading action note", "deploy_id", deployID, "error", err)
+	}
+	return note
+}
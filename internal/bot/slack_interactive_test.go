@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/slack-go/slack"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+func TestParseDeploymentActionValue(t *testing.T) {
+	value := deploymentActionValue(api.Deployment{Namespace: "prod", ID: "d1"})
+	namespace, id, err := parseDeploymentActionValue(value)
+	if err != nil || namespace != "prod" || id != "d1" {
+		t.Errorf("parseDeploymentActionValue(%q) = %q, %q, %v", value, namespace, id, err)
+	}
+	for _, value := range []string{"", "prod", "prod/"} {
+		if _, _, err := parseDeploymentActionValue(value); err == nil {
+			t.Errorf("parseDeploymentActionValue(%q) succeeded", value)
+		}
+	}
+}
+
+// signedInteraction builds a button click request signed the way slack signs them.
+func signedInteraction(t *testing.T, secret string, cb slack.InteractionCallback) *http.Request {
+	t.Helper()
+	payload, err := json.Marshal(cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := url.Values{"payload": {string(payload)}}.Encode()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	r := httptest.NewRequest(http.MethodPost, "/slack/interactive", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestHandleInteraction(t *testing.T) {
+	promoted := make(chan string, 1)
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Nomad-Index", "1")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/deployment/promote/"):
+			promoted <- strings.TrimPrefix(r.URL.Path, "/v1/deployment/promote/")
+			_, _ = w.Write([]byte(`{}`))
+		case r.URL.Path == "/v1/deployment/d1":
+			_ = json.NewEncoder(w).Encode(api.Deployment{ID: "d1", JobID: "web", Namespace: "prod", Status: "running"})
+		default:
+			// the job is optional for the message
+			http.NotFound(w, r)
+		}
+	}))
+	defer nomad.Close()
+	nomadClient, err := api.NewClient(&api.Config{Address: nomad.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := make(chan string, 1)
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.URL.Path == "/chat.update" {
+			updated <- r.Form.Get("ts")
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer slackAPI.Close()
+
+	templates, err := NewTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &slackBot{
+		name:   "slack",
+		api:    slack.New("xoxb-test", slack.OptionAPIURL(slackAPI.URL+"/")),
+		store:  store.NewMemory(nil),
+		nomad:  nomadClient,
+		secret: "secret",
+		cfg:    Config{Templates: templates},
+		L:      slog.Default(),
+	}
+
+	cb := slack.InteractionCallback{
+		Type:       slack.InteractionTypeInteractionMessage,
+		CallbackID: deploymentCallbackID,
+		MessageTs:  "123.456",
+		User:       slack.User{ID: "U1", Name: "alice"},
+		Channel:    slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}}},
+		ActionCallback: slack.ActionCallbacks{AttachmentActions: []*slack.AttachmentAction{
+			{Name: actionPromote, Value: "prod/d1"},
+		}},
+	}
+
+	w := httptest.NewRecorder()
+	b.handleInteraction(w, signedInteraction(t, "other secret", cb))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrongly signed request: code = %d, want 401", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	b.handleInteraction(w, signedInteraction(t, "secret", cb))
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", w.Code)
+	}
+
+	for name, ch := range map[string]chan string{"promoted deployment": promoted, "updated message": updated} {
+		select {
+		case got := <-ch:
+			t.Logf("%s: %s", name, got)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s", name)
+		}
+	}
+	note := b.actionNote("d1")
+	if !strings.HasPrefix(note, "promote by <@U1>: ok") {
+		t.Errorf("actionNote() = %q", note)
+	}
+}
@@ -0,0 +1,515 @@
+package bot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+const (
+	smtpTLSStartTLS = "starttls"
+	smtpTLSImplicit = "tls"
+	smtpTLSNone     = "none"
+
+	// kindThread keeps the Message-ID of the first mail about a deployment, later mails reply to it
+	kindThread = "thread"
+)
+
+var smtpHTMLTemplate = template.Must(template.New("mail").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+{{- range .}}
+<div style="border-left: 4px solid {{.Color}}; padding-left: 12px; margin-bottom: 24px">
+<h3>{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h3>
+{{- if .Summary}}<p>{{.Summary}}</p>{{end}}
+{{- range .Fields}}
+<p><b>{{.Title}}</b><br><span style="white-space: pre-wrap">{{.Value}}</span></p>
+{{- end}}
+{{- range .Links}}
+<p><a href="{{.URL}}">{{.Title}}</a></p>
+{{- end}}
+{{- if .Footer}}<p style="color: #888; font-size: small">{{.Footer}}</p>{{end}}
+</div>
+{{- end}}
+</body></html>
+`))
+
+// smtpSection is one notification in a mail, digests have several.
+type smtpSection struct {
+	Notification
+	Color string
+}
+
+type smtpRecipient struct {
+	address string
+	route   compiledRoute
+}
+
+func newSMTPBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.SMTP) == 0 {
+		return nil, fmt.Errorf("please set smtp host and sender to enable smtp bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.SMTP {
+		if c.Host == "" || c.From == "" {
+			return nil, fmt.Errorf("smtp %q: host and from are required", c.Name)
+		}
+		from, err := mail.ParseAddress(c.From)
+		if err != nil {
+			return nil, fmt.Errorf("smtp %q: invalid from: %w", c.Name, err)
+		}
+		if c.TLS == "" {
+			c.TLS = smtpTLSStartTLS
+		}
+		if c.Port == 0 {
+			switch c.TLS {
+			case smtpTLSImplicit:
+				c.Port = 465
+			case smtpTLSStartTLS:
+				c.Port = 587
+			default:
+				c.Port = 25
+			}
+		}
+		switch c.TLS {
+		case smtpTLSStartTLS, smtpTLSImplicit, smtpTLSNone:
+		default:
+			return nil, fmt.Errorf("smtp %q: unsupported tls mode %q", c.Name, c.TLS)
+		}
+		tlsConfig, err := smtpTLSConfig(c)
+		if err != nil {
+			return nil, fmt.Errorf("smtp %q: %w", c.Name, err)
+		}
+
+		b := &smtpBot{
+			name:      c.Name,
+			cfg:       c,
+			from:      from,
+			store:     cfg.Store,
+			tlsConfig: tlsConfig,
+			domain:    from.Address[strings.LastIndex(from.Address, "@")+1:],
+			L:         slog.With("bot", "smtp", "instance", c.Name),
+		}
+		b.cfg.To = nil
+		for _, addr := range c.To {
+			a, err := mail.ParseAddress(addr)
+			if err != nil {
+				return nil, fmt.Errorf("smtp %q: invalid to %q: %w", c.Name, addr, err)
+			}
+			b.cfg.To = append(b.cfg.To, a.Address)
+		}
+		for _, r := range c.Recipients {
+			a, err := mail.ParseAddress(r.Address)
+			if err != nil {
+				return nil, fmt.Errorf("smtp %q: invalid recipient %q: %w", c.Name, r.Address, err)
+			}
+			route, err := compileRoute(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("smtp %q: recipient %q: %w", c.Name, r.Address, err)
+			}
+			b.recipients = append(b.recipients, smtpRecipient{address: a.Address, route: route})
+		}
+		bots = append(bots, b)
+	}
+
+	return bots, nil
+}
+
+// smtpTLSConfig verifies the server with the CAs of TLSCAFile if set, the system ones otherwise.
+func smtpTLSConfig(c SMTPConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: c.Host, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.TLSCAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(c.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tls ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in tls ca file %s", c.TLSCAFile)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// smtpBot mails failed deployments and allocation failures, mails about one deployment are threaded.
+// With a digest interval, the notifications of each recipient are collected and mailed together instead.
+type smtpBot struct {
+	mu         sync.Mutex
+	name       string
+	cfg        SMTPConfig
+	from       *mail.Address
+	domain     string
+	recipients []smtpRecipient
+	store      store.MessageStore
+	tlsConfig  *tls.Config
+	L          *slog.Logger
+
+	// pending notifications of the digest by recipient, flushed when digestTimer fires
+	pending     map[string][]Notification
+	digestTimer *time.Timer
+	// flushing is held while a digest is sent, so Close waits for a flush of the timer
+	flushing sync.Mutex
+}
+
+func (b *smtpBot) Name() string {
+	return b.name
+}
+
+func (b *smtpBot) Type() string {
+	return "smtp"
+}
+
+func (b *smtpBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !smtpWanted(n) {
+		return "", nil
+	}
+	to := b.recipientsFor(n)
+	if len(to) == 0 {
+		b.L.Debug("no recipients", "kind", n.Kind, "key", n.Key)
+		return "", nil
+	}
+
+	// deployments and allocations repeat their state on every progress update, each state is mailed once
+	var stateKey *store.Key
+	state := smtpState(n)
+	if n.Key != "" {
+		key := store.Key{Backend: b.name, Kind: n.Kind, ID: n.Key}
+		last, found, err := b.store.Get(key)
+		if err != nil {
+			b.L.Warn("error reading mailed state", "key", key, "error", err)
+		}
+		if found && last == state {
+			b.L.Debug("already mailed, skipping", "kind", n.Kind, "key", n.Key)
+			return "", nil
+		}
+		stateKey = &key
+	}
+	saveState := func() {
+		if stateKey == nil {
+			return
+		}
+		if err := b.store.Set(*stateKey, state, n.TTL); err != nil {
+			b.L.Warn("error saving mailed state", "key", *stateKey, "error", err)
+		}
+	}
+
+	if b.cfg.Digest > 0 {
+		b.queue(to, n)
+		saveState()
+		return "", nil
+	}
+
+	headers := map[string]string{}
+	messageID := b.newMessageID()
+	subject := n.Title
+	// the first mail about a deployment starts its thread, all mails of the thread have the same subject
+	// as some clients only thread mails with the same subject
+	var threadKey *store.Key
+	if deployID := deploymentIDOf(n); deployID != "" {
+		subject = fmt.Sprintf("%s deployment %s", n.Subject.JobID, shortID(deployID))
+
+		key := store.Key{Backend: b.name, Kind: kindThread, ID: deployID}
+		root, found, err := b.store.Get(key)
+		if err != nil {
+			b.L.Warn("error reading mail thread", "deploy_id", deployID, "error", err)
+		}
+		if found {
+			subject = "Re: " + subject
+			headers["In-Reply-To"] = root
+			headers["References"] = root
+		} else {
+			threadKey = &key
+		}
+	}
+
+	if err := b.mail(to, subject, messageID, headers, []Notification{n}); err != nil {
+		return "", err
+	}
+	if threadKey != nil {
+		if err := b.store.Set(*threadKey, messageID, maxDeployTTL); err != nil {
+			b.L.Warn("error saving mail thread", "key", *threadKey, "error", err)
+		}
+	}
+	saveState()
+	b.L.Debug("sent mail", "kind", n.Kind, "key", n.Key, "to", to, "message_id", messageID)
+
+	return messageID, nil
+}
+
+// smtpWanted reports whether n is a failed deployment or an allocation failure.
+func smtpWanted(n Notification) bool {
+	switch n.Kind {
+	case KindDeployment:
+		return n.Severity == SeverityError
+	case KindAllocation:
+		return true
+	default:
+		return false
+	}
+}
+
+// smtpState identifies what a mail about n says, updates with only the progress changed have the same state.
+func smtpState(n Notification) string {
+	sum := sha256.Sum256([]byte(string(n.Severity) + "\n" + n.Title + "\n" + n.Summary))
+	return hex.EncodeToString(sum[:])
+}
+
+// shortID is the prefix of a nomad UUID the nomad cli shows.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// recipientsFor returns the default recipients and the ones whose conditions match n.
+func (b *smtpBot) recipientsFor(n Notification) []string {
+	seen := make(map[string]bool)
+	var to []string
+	add := func(addr string) {
+		if !seen[addr] {
+			seen[addr] = true
+			to = append(to, addr)
+		}
+	}
+	for _, addr := range b.cfg.To {
+		add(addr)
+	}
+	for _, r := range b.recipients {
+		if r.route.matches(n.Subject) {
+			add(r.address)
+		}
+	}
+	return to
+}
+
+// queue adds n to the digest of each recipient, mu must be held.
+func (b *smtpBot) queue(to []string, n Notification) {
+	if b.pending == nil {
+		b.pending = make(map[string][]Notification)
+	}
+	for _, addr := range to {
+		b.pending[addr] = append(b.pending[addr], n)
+	}
+	if b.digestTimer == nil {
+		b.digestTimer = time.AfterFunc(b.cfg.Digest, b.flushDigest)
+	}
+}
+
+// flushDigest mails the pending notifications, mu is only held to take them so Post does not wait for the mails.
+func (b *smtpBot) flushDigest() {
+	b.flushing.Lock()
+	defer b.flushing.Unlock()
+
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	if b.digestTimer != nil {
+		b.digestTimer.Stop()
+		b.digestTimer = nil
+	}
+	b.mu.Unlock()
+
+	for _, addr := range sortedKeys(pending) {
+		notifications := pending[addr]
+		subject := fmt.Sprintf("%d nomad notifications", len(notifications))
+		if len(notifications) == 1 {
+			subject = notifications[0].Title
+		}
+		if err := b.mail([]string{addr}, subject, b.newMessageID(), nil, notifications); err != nil {
+			b.L.Error("error sending digest", "to", addr, "notifications", len(notifications), "error", err)
+			continue
+		}
+		b.L.Debug("sent digest", "to", addr, "notifications", len(notifications))
+	}
+}
+
+// Close mails the pending digest, so notifications are not lost on shutdown.
+func (b *smtpBot) Close() error {
+	b.flushDigest()
+	return nil
+}
+
+func (b *smtpBot) newMessageID() string {
+	var r [12]byte
+	_, _ = rand.Read(r[:])
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(r[:]), b.domain)
+}
+
+// mail sends notifications as one multipart mail with a plain text and a html part.
+func (b *smtpBot) mail(to []string, subject, messageID string, headers map[string]string, notifications []Notification) error {
+	msg, err := b.message(to, subject, messageID, headers, notifications)
+	if err != nil {
+		return err
+	}
+	return b.send(to, msg)
+}
+
+func (b *smtpBot) message(to []string, subject, messageID string, headers map[string]string, notifications []Notification) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	var text strings.Builder
+	var sections []smtpSection
+	for i, n := range notifications {
+		if i > 0 {
+			text.WriteString("\n----\n\n")
+		}
+		writeMailText(&text, n)
+		sections = append(sections, smtpSection{Notification: n, Color: slackColorForSeverity(n.Severity)})
+	}
+	var html bytes.Buffer
+	if err := smtpHTMLTemplate.Execute(&html, sections); err != nil {
+		return nil, fmt.Errorf("error rendering mail: %w", err)
+	}
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text.String()},
+		{"text/html; charset=utf-8", html.String()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	writeHeader := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	writeHeader("From", b.from.String())
+	writeHeader("To", strings.Join(to, ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageID)
+	for _, name := range sortedKeys(headers) {
+		writeHeader(name, headers[name])
+	}
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func writeMailText(w *strings.Builder, n Notification) {
+	w.WriteString(n.Title + "\n")
+	if n.URL != "" {
+		w.WriteString(n.URL + "\n")
+	}
+	if n.Summary != "" {
+		w.WriteString("\n" + n.Summary + "\n")
+	}
+	for _, f := range n.Fields {
+		fmt.Fprintf(w, "\n%s\n%s\n", f.Title, strings.TrimSpace(f.Value))
+	}
+	for _, l := range n.Links {
+		fmt.Fprintf(w, "\n%s: %s\n", l.Title, l.URL)
+	}
+	if n.Footer != "" {
+		w.WriteString("\n" + n.Footer + "\n")
+	}
+}
+
+// send delivers msg with the tls mode of the instance.
+func (b *smtpBot) send(to []string, msg []byte) error {
+	addr := net.JoinHostPort(b.cfg.Host, strconv.Itoa(b.cfg.Port))
+	tlsConfig := b.tlsConfig
+	timeout := 30 * time.Second
+
+	var conn net.Conn
+	var err error
+	if b.cfg.TLS == smtpTLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(2 * timeout))
+
+	c, err := smtp.NewClient(conn, b.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	if b.cfg.TLS == smtpTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("error starting tls: %w", err)
+		}
+	}
+	if b.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", b.cfg.Username, b.cfg.Password, b.cfg.Host)); err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+
+	if err := c.Mail(b.from.Address); err != nil {
+		return fmt.Errorf("error sending MAIL FROM: %w", err)
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return fmt.Errorf("error sending RCPT TO %s: %w", addr, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("error sending DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	return c.Quit()
+}
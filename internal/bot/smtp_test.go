@@ -0,0 +1,312 @@
+package bot
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+type receivedMail struct {
+	from string
+	to   []string
+	msg  *mail.Message
+}
+
+// smtpStandIn is a local SMTP server accepting every mail, with STARTTLS if tlsConfig is set.
+type smtpStandIn struct {
+	t         *testing.T
+	ln        net.Listener
+	tlsConfig *tls.Config
+
+	mu    sync.Mutex
+	mails []receivedMail
+}
+
+func newSMTPStandIn(t *testing.T, tlsConfig *tls.Config) *smtpStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{t: t, ln: ln, tlsConfig: tlsConfig}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) received() []receivedMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedMail(nil), s.mails...)
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+	var cur receivedMail
+	secure := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			if s.tlsConfig != nil && !secure {
+				reply("250-localhost")
+				reply("250 STARTTLS")
+			} else {
+				reply("250 localhost")
+			}
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, secure = tlsConn, bufio.NewReader(tlsConn), true
+		case "MAIL":
+			cur = receivedMail{from: strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")}
+			reply("250 ok")
+		case "RCPT":
+			cur.to = append(cur.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg, err := mail.ReadMessage(strings.NewReader(data.String()))
+			if err != nil {
+				s.t.Errorf("invalid mail: %v", err)
+				reply("554 invalid mail")
+				continue
+			}
+			cur.msg = msg
+			s.mu.Lock()
+			s.mails = append(s.mails, cur)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// testCA returns a server certificate for 127.0.0.1 and the file of the CA it is signed by.
+func testCA(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, file
+}
+
+func newTestSMTPBot(t *testing.T, c SMTPConfig) *smtpBot {
+	t.Helper()
+	c.Name = "smtp"
+	c.Host = "127.0.0.1"
+	c.From = "Nomad <nomad@example.com>"
+	if len(c.To) == 0 {
+		c.To = []string{"ops@example.com"}
+	}
+	impls, err := newSMTPBot(Config{SMTP: []SMTPConfig{c}, Store: store.NewMemory(nil)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return impls[0].(*smtpBot)
+}
+
+func failedDeployment(description string) Notification {
+	n := deploymentNotification(api.Deployment{
+		ID: "d1234567-89ab-cdef-0123-456789abcdef", JobID: "web", Namespace: "default",
+		Status: "failed", StatusDescription: description,
+	}, nil, "http://nomad:4646")
+	n.Title = "web deployment failed"
+	n.Summary = description
+	n.TTL = time.Hour
+	return n
+}
+
+func TestSMTPThreadsAndSkipsUnchanged(t *testing.T) {
+	srv := newSMTPStandIn(t, nil)
+	b := newTestSMTPBot(t, SMTPConfig{Port: srv.port(), TLS: smtpTLSNone})
+
+	if _, err := b.Post(failedDeployment("Failed due to unhealthy allocations")); err != nil {
+		t.Fatal(err)
+	}
+	// the same state with only progress changed
+	if _, err := b.Post(failedDeployment("Failed due to unhealthy allocations")); err != nil {
+		t.Fatal(err)
+	}
+	// successful deployments are not mailed
+	ok := failedDeployment("Deployment completed successfully")
+	ok.Severity = SeveritySuccess
+	if _, err := b.Post(ok); err != nil {
+		t.Fatal(err)
+	}
+
+	alloc := allocationNotification(api.Allocation{
+		ID: "a1", JobID: "web", Namespace: "default", DeploymentID: "d1234567-89ab-cdef-0123-456789abcdef",
+	}, nil, "http://nomad:4646")
+	alloc.Title = "a1 allocation update"
+	if _, err := b.Post(alloc); err != nil {
+		t.Fatal(err)
+	}
+
+	mails := srv.received()
+	if len(mails) != 2 {
+		t.Fatalf("received %d mails, want 2", len(mails))
+	}
+	first, second := mails[0].msg.Header, mails[1].msg.Header
+	if mails[0].from != "nomad@example.com" || strings.Join(mails[0].to, ",") != "ops@example.com" {
+		t.Errorf("envelope = %s -> %v", mails[0].from, mails[0].to)
+	}
+	if got := first.Get("Subject"); got != "web deployment d1234567" {
+		t.Errorf("subject = %q", got)
+	}
+	if got := second.Get("Subject"); got != "Re: web deployment d1234567" {
+		t.Errorf("reply subject = %q", got)
+	}
+	if second.Get("In-Reply-To") != first.Get("Message-Id") || second.Get("References") != first.Get("Message-Id") {
+		t.Errorf("reply is not threaded: In-Reply-To %q, References %q, Message-ID %q",
+			second.Get("In-Reply-To"), second.Get("References"), first.Get("Message-Id"))
+	}
+}
+
+func TestSMTPDigestSentOnClose(t *testing.T) {
+	srv := newSMTPStandIn(t, nil)
+	b := newTestSMTPBot(t, SMTPConfig{Port: srv.port(), TLS: smtpTLSNone, Digest: time.Hour})
+
+	for _, description := range []string{"Failed due to unhealthy allocations", "Deployment marked as failed"} {
+		if _, err := b.Post(failedDeployment(description)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(srv.received()); n != 0 {
+		t.Fatalf("received %d mails before the digest interval", n)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mails := srv.received()
+	if len(mails) != 1 {
+		t.Fatalf("received %d mails, want one digest", len(mails))
+	}
+	if got := mails[0].msg.Header.Get("Subject"); got != "2 nomad notifications" {
+		t.Errorf("subject = %q", got)
+	}
+}
+
+func TestSMTPStartTLS(t *testing.T) {
+	cert, caFile := testCA(t)
+	srv := newSMTPStandIn(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	cases := []struct {
+		name    string
+		cfg     SMTPConfig
+		wantErr bool
+	}{
+		{name: "ca file", cfg: SMTPConfig{TLSCAFile: caFile}},
+		{name: "insecure skip verify", cfg: SMTPConfig{InsecureSkipVerify: true}},
+		{name: "system roots", cfg: SMTPConfig{}, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.cfg.Port = srv.port()
+			b := newTestSMTPBot(t, c.cfg)
+			_, err := b.Post(failedDeployment("Failed due to unhealthy allocations"))
+			if (err != nil) != c.wantErr {
+				t.Errorf("Post() error = %v, want error %v", err, c.wantErr)
+			}
+		})
+	}
+	if n := len(srv.received()); n != 2 {
+		t.Errorf("received %d mails, want 2", n)
+	}
+}
+
+func TestSMTPTLSCAFileInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := SMTPConfig{Instance: Instance{Name: "smtp"}, Host: "127.0.0.1", From: "nomad@example.com", TLSCAFile: file}
+	if _, err := newSMTPBot(Config{SMTP: []SMTPConfig{c}}, ""); err == nil {
+		t.Error("invalid tls ca file accepted")
+	}
+	c.TLSCAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := newSMTPBot(Config{SMTP: []SMTPConfig{c}}, ""); err == nil {
+		t.Error("missing tls ca file accepted")
+	}
+}
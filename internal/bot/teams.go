@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+// teams messages are adaptive cards posted to an incoming webhook.
+// ref https://learn.microsoft.com/en-us/microsoftteams/platform/webhooks-and-connectors/how-to/connectors-using#send-adaptive-cards-using-an-incoming-webhook
+// ref https://adaptivecards.io/explorer/
+
+const (
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+
+	// kindPostedStatus keeps the status of the last card posted for a deployment
+	kindPostedStatus = "posted-status"
+)
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []adaptiveElement `json:"body"`
+	Actions []adaptiveAction  `json:"actions,omitempty"`
+	MSTeams map[string]string `json:"msteams,omitempty"`
+}
+
+// adaptiveElement is a TextBlock, FactSet or Container, depending on Type.
+type adaptiveElement struct {
+	Type string `json:"type"`
+
+	// TextBlock
+	Text     string `json:"text,omitempty"`
+	Weight   string `json:"weight,omitempty"`
+	Size     string `json:"size,omitempty"`
+	Color    string `json:"color,omitempty"`
+	IsSubtle bool   `json:"isSubtle,omitempty"`
+	Wrap     bool   `json:"wrap,omitempty"`
+
+	// FactSet
+	Facts []adaptiveFact `json:"facts,omitempty"`
+
+	// Container
+	Style string            `json:"style,omitempty"`
+	Items []adaptiveElement `json:"items,omitempty"`
+}
+
+type adaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type adaptiveAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+func newTeamsBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Teams) == 0 {
+		return nil, fmt.Errorf("please set teams webhook url to enable teams bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.Teams {
+		if c.WebhookURL == "" {
+			return nil, fmt.Errorf("teams %q: webhook url is required", c.Name)
+		}
+		bots = append(bots, &teamsBot{
+			name:       c.Name,
+			client:     resty.New(),
+			webhookURL: c.WebhookURL,
+			posted:     postedStatus{backend: c.Name, store: cfg.Store},
+			L:          slog.With("bot", "teams", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+// teamsBot can not edit messages, incoming webhooks do not return the ID of the posted message.
+// A deployment gets a new card only when its status changes, not for every progress update.
+type teamsBot struct {
+	mu         sync.Mutex
+	name       string
+	webhookURL string
+	client     *resty.Client
+	posted     postedStatus
+	L          *slog.Logger
+}
+
+func (b *teamsBot) Name() string {
+	return b.name
+}
+
+func (b *teamsBot) Type() string {
+	return "teams"
+}
+
+func (b *teamsBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	unchanged, err := b.posted.unchanged(n)
+	if err != nil {
+		return "", err
+	}
+	if unchanged {
+		b.L.Debug("deployment status unchanged, skipping", "key", n.Key)
+		return "", nil
+	}
+
+	msg := b.message(n)
+
+	res, err := b.client.R().SetBody(msg).Post(b.webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to post, err=%w", err)
+	}
+	if res.StatusCode() >= 300 {
+		return "", fmt.Errorf("failed to create message %s, code=%v", res.Body(), res.StatusCode())
+	}
+	b.L.Debug("created message success", "kind", n.Kind, "key", n.Key, "response", string(res.Body()))
+
+	return "", b.posted.save(n)
+}
+
+// postedStatus remembers the deployment status last posted by a backend that can not edit messages,
+// so progress updates not changing the status do not post a new message each.
+type postedStatus struct {
+	backend string
+	store   store.MessageStore
+}
+
+func (p postedStatus) key(n Notification) store.Key {
+	return store.Key{Backend: p.backend, Kind: kindPostedStatus, ID: deploymentIDOf(n)}
+}
+
+// unchanged returns true if n is about a deployment whose status was already posted.
+func (p postedStatus) unchanged(n Notification) (bool, error) {
+	status := deploymentStatusOf(n)
+	if status == "" {
+		return false, nil
+	}
+	last, found, err := p.store.Get(p.key(n))
+	if err != nil {
+		return false, err
+	}
+	return found && last == status, nil
+}
+
+// save records the status of the deployment n is about as posted.
+func (p postedStatus) save(n Notification) error {
+	status := deploymentStatusOf(n)
+	if status == "" {
+		return nil
+	}
+	return p.store.Set(p.key(n), status, n.TTL)
+}
+
+// deploymentStatusOf is the status and status description of the deployment n is about, empty for other kinds.
+// The description tells e.g. that a running deployment now needs to be promoted.
+func deploymentStatusOf(n Notification) string {
+	if n.Kind != KindDeployment || n.data == nil || n.data.Deployment == nil {
+		return ""
+	}
+	return n.data.Deployment.Status + ": " + n.data.Deployment.StatusDescription
+}
+
+// deploymentIDOf is the deployment n belongs to, empty if none.
+func deploymentIDOf(n Notification) string {
+	if n.data == nil {
+		return ""
+	}
+	if n.data.Deployment != nil {
+		return n.data.Deployment.ID
+	}
+	if n.data.Allocation != nil {
+		return n.data.Allocation.DeploymentID
+	}
+	return ""
+}
+
+func (b *teamsBot) message(n Notification) teamsMessage {
+	header := []adaptiveElement{{
+		Type:   "TextBlock",
+		Text:   n.Title,
+		Weight: "Bolder",
+		Size:   "Medium",
+		Color:  teamsColorForSeverity(n.Severity),
+		Wrap:   true,
+	}}
+	if n.Summary != "" {
+		header = append(header, adaptiveElement{Type: "TextBlock", Text: n.Summary, Wrap: true})
+	}
+
+	body := []adaptiveElement{{
+		Type:  "Container",
+		Style: teamsStyleForSeverity(n.Severity),
+		Items: header,
+	}}
+
+	// single line fields such as the task group counts are facts, multi line ones such as task events text blocks
+	var facts []adaptiveFact
+	for _, f := range n.Fields {
+		if !strings.Contains(f.Value, "\n") {
+			facts = append(facts, adaptiveFact{Title: f.Title, Value: f.Value})
+			continue
+		}
+		body = append(body,
+			adaptiveElement{Type: "TextBlock", Text: f.Title, Weight: "Bolder", Wrap: true},
+			adaptiveElement{Type: "TextBlock", Text: teamsLineBreaks(f.Value), Wrap: true},
+		)
+	}
+	if len(facts) > 0 {
+		body = append(body, adaptiveElement{Type: "FactSet", Facts: facts})
+	}
+	if n.Footer != "" {
+		body = append(body, adaptiveElement{Type: "TextBlock", Text: n.Footer, Size: "Small", IsSubtle: true, Wrap: true})
+	}
+
+	var actions []adaptiveAction
+	if n.URL != "" {
+		actions = append(actions, adaptiveAction{Type: "Action.OpenUrl", Title: "Open in Nomad", URL: n.URL})
+	}
+	for _, l := range n.Links {
+		actions = append(actions, adaptiveAction{Type: "Action.OpenUrl", Title: l.Title, URL: l.URL})
+	}
+
+	return teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: adaptiveCardContentType,
+			Content: adaptiveCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    body,
+				Actions: actions,
+				MSTeams: map[string]string{"width": "Full"},
+			},
+		}},
+	}
+}
+
+// teamsLineBreaks keeps line breaks, text blocks render markdown where a single newline is no break.
+func teamsLineBreaks(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n\n")
+}
+
+func teamsColorForSeverity(severity Severity) string {
+	switch severity {
+	case SeverityError:
+		return "Attention"
+	case SeverityInfo:
+		return "Accent"
+	case SeveritySuccess:
+		return "Good"
+	case SeverityWarning:
+		return "Warning"
+	default:
+		return "Default"
+	}
+}
+
+func teamsStyleForSeverity(severity Severity) string {
+	switch severity {
+	case SeverityError:
+		return "attention"
+	case SeverityInfo:
+		return "accent"
+	case SeveritySuccess:
+		return "good"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "emphasis"
+	}
+}
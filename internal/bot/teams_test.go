@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/ttys3/nomad-event-notifier/internal/store"
+)
+
+func TestTeamsPostsStatusChanges(t *testing.T) {
+	var titles []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg teamsMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		titles = append(titles, msg.Attachments[0].Content.Body[0].Items[0].Text)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	impls, err := newTeamsBot(Config{
+		Teams: []TeamsConfig{{Instance: Instance{Name: "ops"}, WebhookURL: srv.URL}},
+		Store: store.NewMemory(nil),
+	}, "http://nomad:4646")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := impls[0]
+
+	updates := []api.Deployment{
+		{Status: "running", StatusDescription: "Deployment is running"},
+		{Status: "running", StatusDescription: "Deployment is running", TaskGroups: map[string]*api.DeploymentState{"web": {PlacedAllocs: 1}}},
+		{Status: "running", StatusDescription: "Deployment is running but requires manual promotion"},
+		{Status: "running", StatusDescription: "Deployment is running but requires manual promotion"},
+		{Status: "successful", StatusDescription: "Deployment completed successfully"},
+		{Status: "successful", StatusDescription: "Deployment completed successfully"},
+	}
+	for _, deploy := range updates {
+		deploy.ID = "d1"
+		deploy.JobID = "web"
+		n := deploymentNotification(deploy, nil, "http://nomad:4646")
+		n.Title = deploy.Status
+		n.TTL = time.Hour
+		if _, err := b.Post(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"running", "running", "successful"}
+	if len(titles) != len(want) {
+		t.Fatalf("posted %v, want %v", titles, want)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Errorf("card %d = %q, want %q", i, titles[i], want[i])
+		}
+	}
+}
+
+func TestTeamsPostsOtherKinds(t *testing.T) {
+	posts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+	}))
+	defer srv.Close()
+
+	b := &teamsBot{name: "ops", webhookURL: srv.URL, client: resty.New(), posted: postedStatus{backend: "ops", store: store.NewMemory(nil)}, L: slog.Default()}
+	for i := 0; i < 2; i++ {
+		if _, err := b.Post(Notification{Kind: KindNode, Title: "node drained"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if posts != 2 {
+		t.Errorf("posts = %d, want 2", posts)
+	}
+}
@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	telegramParseModeHTML       = "HTML"
+	telegramParseModeMarkdownV2 = "MarkdownV2"
+
+	// telegramTextLimit is the maximum length of a message text after entities parsing
+	telegramTextLimit = 4096
+)
+
+// telegramFormat renders the markup of one parse mode, every text has to be escaped.
+// ref https://core.telegram.org/bots/api#formatting-options
+type telegramFormat struct {
+	escape func(s string) string
+	bold   func(s string) string
+	italic func(s string) string
+	code   func(s string) string
+	link   func(text, url string) string
+}
+
+var telegramFormats = map[string]telegramFormat{
+	telegramParseModeHTML: {
+		escape: html.EscapeString,
+		bold:   func(s string) string { return "<b>" + html.EscapeString(s) + "</b>" },
+		italic: func(s string) string { return "<i>" + html.EscapeString(s) + "</i>" },
+		code:   func(s string) string { return "<pre>" + html.EscapeString(s) + "</pre>" },
+		link: func(text, url string) string {
+			return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), html.EscapeString(text))
+		},
+	},
+	telegramParseModeMarkdownV2: {
+		escape: escapeMarkdownV2,
+		bold:   func(s string) string { return "*" + escapeMarkdownV2(s) + "*" },
+		italic: func(s string) string { return "_" + escapeMarkdownV2(s) + "_" },
+		code:   func(s string) string { return "```\n" + markdownV2CodeEscaper.Replace(s) + "\n```" },
+		link: func(text, url string) string {
+			return "[" + escapeMarkdownV2(text) + "](" + markdownV2URLEscaper.Replace(url) + ")"
+		},
+	},
+}
+
+var (
+	markdownV2Escaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`",
+		">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	markdownV2CodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	markdownV2URLEscaper  = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+)
+
+func escapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+// telegramResponse is the envelope of all bot api responses.
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      telegramMessage `json:"result"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+}
+
+func newTelegramBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Telegram) == 0 {
+		return nil, fmt.Errorf("please set telegram token and chat id to enable telegram bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.Telegram {
+		if c.Token == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("telegram %q: token and chat id are required", c.Name)
+		}
+		parseMode := c.ParseMode
+		if parseMode == "" {
+			parseMode = telegramParseModeHTML
+		}
+		format, ok := telegramFormats[parseMode]
+		if !ok {
+			return nil, fmt.Errorf("telegram %q: unsupported parse mode %q", c.Name, parseMode)
+		}
+		apiURL := c.APIURL
+		if apiURL == "" {
+			apiURL = "https://api.telegram.org"
+		}
+
+		bots = append(bots, &telegramBot{
+			name:      c.Name,
+			client:    resty.New().SetBaseURL(strings.TrimSuffix(apiURL, "/") + "/bot" + c.Token),
+			token:     c.Token,
+			chatID:    c.ChatID,
+			parseMode: parseMode,
+			format:    format,
+			L:         slog.With("bot", "telegram", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+type telegramBot struct {
+	mu        sync.Mutex
+	name      string
+	token     string
+	chatID    string
+	parseMode string
+	format    telegramFormat
+	client    *resty.Client
+	L         *slog.Logger
+}
+
+func (b *telegramBot) Name() string {
+	return b.name
+}
+
+func (b *telegramBot) Type() string {
+	return "telegram"
+}
+
+func (b *telegramBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// ref https://core.telegram.org/bots/api#sendmessage
+	r, err := b.call("sendMessage", map[string]any{
+		"chat_id":              b.chatID,
+		"text":                 b.text(n),
+		"parse_mode":           b.parseMode,
+		"link_preview_options": map[string]bool{"is_disabled": true},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send message, err=%w", err)
+	}
+	b.L.Debug("created message success", "telegram_message_id", r.Result.MessageID, "kind", n.Kind, "key", n.Key)
+
+	return strconv.FormatInt(r.Result.MessageID, 10), nil
+}
+
+func (b *telegramBot) Update(messageID string, n Notification) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid telegram message id %q: %w", messageID, err)
+	}
+
+	// ref https://core.telegram.org/bots/api#editmessagetext
+	_, err = b.call("editMessageText", map[string]any{
+		"chat_id":              b.chatID,
+		"message_id":           id,
+		"text":                 b.text(n),
+		"parse_mode":           b.parseMode,
+		"link_preview_options": map[string]bool{"is_disabled": true},
+	})
+	// editing a message to the same text fails, e.g. on replayed events
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return fmt.Errorf("failed to update previous message, id=%v, err=%w", messageID, err)
+	}
+	b.L.Debug("updated message", "telegram_message_id", messageID, "kind", n.Kind, "key", n.Key)
+
+	return nil
+}
+
+func (b *telegramBot) call(method string, body map[string]any) (telegramResponse, error) {
+	var r telegramResponse
+	res, err := b.client.R().SetBody(body).SetResult(&r).SetError(&r).Post("/" + method)
+	if err != nil {
+		return r, errors.New(b.redact(err.Error()))
+	}
+	if res.StatusCode() >= 300 || !r.OK {
+		return r, fmt.Errorf("%s, code=%v", b.redact(r.Description), res.StatusCode())
+	}
+	return r, nil
+}
+
+// redact removes the bot token from s, it is part of the request URL which errors of the http client include.
+func (b *telegramBot) redact(s string) string {
+	return strings.ReplaceAll(s, b.token, "<redacted>")
+}
+
+// text renders n in the parse mode of the bot, fields not fitting the length limit of telegram are left out.
+func (b *telegramBot) text(n Notification) string {
+	f := b.format
+
+	title := f.bold(n.Title)
+	if n.URL != "" {
+		title = f.link(n.Title, n.URL)
+		if b.parseMode == telegramParseModeHTML {
+			title = "<b>" + title + "</b>"
+		} else {
+			title = "*" + title + "*"
+		}
+	}
+
+	parts := []string{title}
+	if n.Summary != "" {
+		parts = append(parts, f.escape(n.Summary))
+	}
+	for _, field := range n.Fields {
+		value := field.Value
+		if strings.Contains(value, "\n") {
+			value = f.code(strings.TrimSpace(value))
+		} else {
+			value = f.escape(value)
+		}
+		if field.Title != "" {
+			value = f.bold(field.Title) + "\n" + value
+		}
+		parts = append(parts, value)
+	}
+	for _, l := range n.Links {
+		parts = append(parts, f.link(l.Title, l.URL))
+	}
+
+	var footer string
+	if n.Footer != "" {
+		footer = f.italic(n.Footer)
+	}
+
+	var text strings.Builder
+	for _, p := range parts {
+		if text.Len()+len(p)+len(footer)+2 > telegramTextLimit {
+			b.L.Warn("message too long, leaving out fields", "kind", n.Kind, "key", n.Key)
+			break
+		}
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		text.WriteString(p)
+	}
+	if footer != "" {
+		text.WriteString("\n\n" + footer)
+	}
+	return text.String()
+}
@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	in := `web_api [v1.2] (canary) *bold* a-b=c! #1 {x} | ~y~ >z ` + "`code`" + ` \`
+	want := `web\_api \[v1\.2\] \(canary\) \*bold\* a\-b\=c\! \#1 \{x\} \| \~y\~ \>z ` + "\\`code\\`" + ` \\`
+	if got := escapeMarkdownV2(in); got != want {
+		t.Errorf("escapeMarkdownV2() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func testTelegramNotification() Notification {
+	return Notification{
+		Title:   "web <deploy> *1*",
+		URL:     "https://nomad/ui/jobs/web_(1)",
+		Summary: "a & b_c",
+		Fields: []Field{
+			{Title: "Task Group: web", Value: "Desired: 1"},
+			{Title: "Events", Value: "line <1>\nline `2`\n"},
+		},
+		Footer: "v1.0",
+	}
+}
+
+func TestTelegramTextHTML(t *testing.T) {
+	b := &telegramBot{parseMode: telegramParseModeHTML, format: telegramFormats[telegramParseModeHTML], L: slog.Default()}
+	want := strings.Join([]string{
+		`<b><a href="https://nomad/ui/jobs/web_(1)">web &lt;deploy&gt; *1*</a></b>`,
+		`a &amp; b_c`,
+		"<b>Task Group: web</b>\nDesired: 1",
+		"<b>Events</b>\n<pre>line &lt;1&gt;\nline `2`</pre>",
+		`<i>v1.0</i>`,
+	}, "\n\n")
+	if got := b.text(testTelegramNotification()); got != want {
+		t.Errorf("text() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTelegramTextMarkdownV2(t *testing.T) {
+	b := &telegramBot{parseMode: telegramParseModeMarkdownV2, format: telegramFormats[telegramParseModeMarkdownV2], L: slog.Default()}
+	want := strings.Join([]string{
+		`*[web <deploy\> \*1\*](https://nomad/ui/jobs/web_(1\))*`,
+		`a & b\_c`,
+		"*Task Group: web*\nDesired: 1",
+		"*Events*\n```\nline <1>\nline \\`2\\`\n```",
+		`_v1\.0_`,
+	}, "\n\n")
+	if got := b.text(testTelegramNotification()); got != want {
+		t.Errorf("text() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTelegramTextLimit(t *testing.T) {
+	b := &telegramBot{parseMode: telegramParseModeHTML, format: telegramFormats[telegramParseModeHTML], L: slog.Default()}
+	n := Notification{
+		Title: "title",
+		Fields: []Field{
+			{Title: "first", Value: strings.Repeat("a", 3000)},
+			{Title: "second", Value: strings.Repeat("b", 3000)},
+		},
+		Footer: "footer",
+	}
+	text := b.text(n)
+	if len(text) > telegramTextLimit {
+		t.Errorf("text is %d bytes, limit is %d", len(text), telegramTextLimit)
+	}
+	if !strings.Contains(text, "first") || strings.Contains(text, "second") || !strings.HasSuffix(text, "<i>footer</i>") {
+		t.Errorf("text() = %q, want the first field and the footer only", text)
+	}
+}
+
+func TestTelegramPostUpdate(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		if body["chat_id"] != "@ops" || body["parse_mode"] != telegramParseModeHTML {
+			t.Errorf("unexpected body %v", body)
+		}
+		methods = append(methods, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/bottoken/sendMessage":
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42}}`))
+		case "/bottoken/editMessageText":
+			if body["message_id"] != float64(42) {
+				t.Errorf("message_id = %v, want 42", body["message_id"])
+			}
+			// replayed events edit the message to the same text
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Bad Request: message is not modified"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	impls, err := newTelegramBot(Config{Telegram: []TelegramConfig{{
+		Instance: Instance{Name: "telegram"}, Token: "token", ChatID: "@ops", APIURL: srv.URL + "/",
+	}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := impls[0].(*telegramBot)
+
+	id, err := b.Post(Notification{Title: "deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "42" {
+		t.Errorf("Post() = %q, want 42", id)
+	}
+	if err := b.Update(id, Notification{Title: "deploy"}); err != nil {
+		t.Errorf("Update() error = %v, want unchanged messages ignored", err)
+	}
+	if err := b.Update("nope", Notification{Title: "deploy"}); err == nil {
+		t.Error("Update() with an invalid message id succeeded")
+	}
+	if want := "/bottoken/sendMessage /bottoken/editMessageText"; strings.Join(methods, " ") != want {
+		t.Errorf("called %v, want %s", methods, want)
+	}
+}
+
+func TestTelegramErrorRedactsToken(t *testing.T) {
+	const token = "123456:secret-token"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"ok":false,"description":"Unauthorized"}`))
+	}))
+
+	impls, err := newTelegramBot(Config{Telegram: []TelegramConfig{{
+		Instance: Instance{Name: "telegram"}, Token: token, ChatID: "@ops", APIURL: srv.URL,
+	}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := impls[0].(*telegramBot)
+
+	if _, err := b.Post(Notification{Title: "deploy"}); err == nil || strings.Contains(err.Error(), token) {
+		t.Errorf("Post() error = %v, want an error without the token", err)
+	}
+
+	// connection errors include the request URL
+	srv.Close()
+	_, err = b.Post(Notification{Title: "deploy"})
+	if err == nil || strings.Contains(err.Error(), token) || !strings.Contains(err.Error(), "/bot<redacted>/sendMessage") {
+		t.Errorf("Post() error = %v, want the URL without the token", err)
+	}
+	if err := b.Update("42", Notification{Title: "deploy"}); err == nil || strings.Contains(err.Error(), token) {
+		t.Errorf("Update() error = %v, want an error without the token", err)
+	}
+}
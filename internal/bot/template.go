@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+	"github.com/ttys3/nomad-event-notifier/version"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// templateKinds are the notification kinds rendered by templates.
+var templateKinds = []string{KindDeployment, KindAllocation}
+
+// backendTypes are the types of all backends, the prefixes of backend specific templates.
+var backendTypes = []string{
+	"slack", "discord", "teams", "mattermost", "telegram", "webhook",
+	"smtp", "pagerduty", "opsgenie", "matrix", "google_chat",
+}
+
+// TemplateData is the data templates are executed with.
+type TemplateData struct {
+	// Deployment is set for deployment notifications
+	Deployment *api.Deployment
+	// Allocation is set for allocation notifications
+	Allocation *api.Allocation
+	// Tasks are the tasks of the allocation with findings
+	Tasks []TaskData
+	// Job is the job of the deployment or allocation, if it could be read
+	Job *api.Job
+	// JobMeta is the meta of Job, empty if unknown
+	JobMeta map[string]string
+	// NomadURL is the external nomad address links point to
+	NomadURL string
+	// Version is the version of nomad-event-notifier
+	Version string
+}
+
+type TaskData struct {
+	Name     string
+	State    *api.TaskState
+	Findings []classify.Finding
+}
+
+var templateFuncs = template.FuncMap{
+	"join":       strings.Join,
+	"taskEvents": taskEventsText,
+	"deref":      stringValue,
+}
+
+// Templates renders the title, summary, fields and footer of notifications.
+// Each kind has a template defining the blocks "title", "summary", "fields" and "footer".
+// The output of "fields" is split into fields at lines starting with "## ", the rest of the heading
+// is the field title and the following lines its value.
+type Templates struct {
+	// templates maps "<kind>" and "<backend>.<kind>" to their template
+	templates map[string]*template.Template
+}
+
+// NewTemplates returns the built-in templates.
+func NewTemplates() (*Templates, error) {
+	t := &Templates{templates: make(map[string]*template.Template)}
+	for _, kind := range templateKinds {
+		name := kind + ".tmpl"
+		tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").
+			ParseFS(builtinTemplates, "templates/"+name)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing built-in template %s: %w", name, err)
+		}
+		t.templates[kind] = tmpl
+	}
+	return t, nil
+}
+
+// LoadTemplates returns the built-in templates overridden by the templates in dir.
+// A file "<kind>.tmpl" applies to all backends, "<backend>.<kind>.tmpl" to one backend only,
+// e.g. "deployment.tmpl" and "slack.deployment.tmpl". Blocks a file does not define keep their default.
+// All templates are validated by executing them with sample data.
+func LoadTemplates(dir string) (*Templates, error) {
+	t, err := NewTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+		backend, kind, ok := strings.Cut(name, ".")
+		if !ok {
+			backend, kind = "", name
+		}
+		if backend != "" && !slices.Contains(backendTypes, backend) {
+			return nil, fmt.Errorf("template %s: unknown backend %q, supported are %s",
+				file, backend, strings.Join(backendTypes, ", "))
+		}
+		base, ok := t.templates[kind]
+		if !ok {
+			return nil, fmt.Errorf("template %s: unknown kind %q, supported are %s",
+				file, kind, strings.Join(templateKinds, ", "))
+		}
+
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template: %w", err)
+		}
+		tmpl, err := base.Clone()
+		if err == nil {
+			tmpl, err = tmpl.Parse(string(text))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %w", file, err)
+		}
+		if _, err := renderTemplate(tmpl, sampleTemplateData(kind)); err != nil {
+			return nil, fmt.Errorf("error validating template %s: %w", file, err)
+		}
+		t.templates[name] = tmpl
+	}
+
+	return t, nil
+}
+
+// sampleTemplateData is the data of a notification of kind with every pointer set,
+// so validating a template catches misspelled fields and fields of the other kinds.
+func sampleTemplateData(kind string) TemplateData {
+	data := TemplateData{
+		Job:     &api.Job{},
+		JobMeta: map[string]string{},
+	}
+	switch kind {
+	case KindDeployment:
+		data.Deployment = &api.Deployment{TaskGroups: map[string]*api.DeploymentState{"example": {}}}
+	case KindAllocation:
+		state := &api.TaskState{Events: []*api.TaskEvent{{Details: map[string]string{}}}}
+		data.Allocation = &api.Allocation{TaskStates: map[string]*api.TaskState{"example": state}}
+		data.Tasks = []TaskData{{Name: "example", State: state, Findings: []classify.Finding{{}}}}
+	}
+	return data
+}
+
+type renderedParts struct {
+	title, summary, footer string
+	fields                 []Field
+}
+
+func renderTemplate(tmpl *template.Template, data TemplateData) (renderedParts, error) {
+	exec := func(name string) (string, error) {
+		if tmpl.Lookup(name) == nil {
+			return "", nil
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+
+	var parts renderedParts
+	var fields string
+	var err error
+	if parts.title, err = exec("title"); err != nil {
+		return parts, err
+	}
+	if parts.summary, err = exec("summary"); err != nil {
+		return parts, err
+	}
+	if fields, err = exec("fields"); err != nil {
+		return parts, err
+	}
+	if parts.footer, err = exec("footer"); err != nil {
+		return parts, err
+	}
+	parts.fields = parseFields(fields)
+	return parts, nil
+}
+
+// parseFields splits text into fields at lines starting with "## ".
+// Text before the first heading becomes a field without title.
+func parseFields(text string) []Field {
+	var fields []Field
+	var cur *Field
+	var value []string
+
+	flush := func() {
+		v := strings.TrimSpace(strings.Join(value, "\n"))
+		if cur != nil {
+			cur.Value = v
+			fields = append(fields, *cur)
+		} else if v != "" {
+			fields = append(fields, Field{Value: v})
+		}
+		value = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if title, ok := strings.CutPrefix(line, "## "); ok {
+			flush()
+			cur = &Field{Title: strings.TrimSpace(title)}
+			continue
+		}
+		value = append(value, line)
+	}
+	flush()
+
+	return fields
+}
+
+// apply renders the template of the kind of n for backend into n,
+// notifications without template data are left as they are.
+func (t *Templates) apply(backend string, n *Notification) error {
+	if n.data == nil {
+		return nil
+	}
+
+	tmpl, ok := t.templates[backend+"."+n.Kind]
+	if !ok {
+		if tmpl, ok = t.templates[n.Kind]; !ok {
+			return nil
+		}
+	}
+
+	parts, err := renderTemplate(tmpl, *n.data)
+	if err != nil {
+		return fmt.Errorf("error rendering %s template: %w", n.Kind, err)
+	}
+	n.Title = parts.title
+	n.Summary = parts.summary
+	n.Fields = parts.fields
+	n.Footer = parts.footer
+	return nil
+}
+
+func newTemplateData(job *api.Job, nomadAddress string) *TemplateData {
+	data := &TemplateData{
+		Job:      job,
+		JobMeta:  map[string]string{},
+		NomadURL: nomadAddress,
+		Version:  version.Version,
+	}
+	if job != nil && job.Meta != nil {
+		data.JobMeta = job.Meta
+	}
+	return data
+}
@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, dir, name, text string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "deployment.tmpl", `{{define "title"}}deploy {{.Deployment.JobID}}{{end}}`)
+	writeTemplate(t, dir, "slack.allocation.tmpl", `{{define "summary"}}{{.Allocation.ClientDescription}}{{end}}`)
+	writeTemplate(t, dir, "google_chat.deployment.tmpl", `{{define "summary"}}{{.Deployment.StatusDescription}}{{end}}`)
+
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{KindDeployment, KindAllocation, "slack." + KindAllocation, "google_chat." + KindDeployment} {
+		if templates.templates[name] == nil {
+			t.Errorf("template %s not loaded", name)
+		}
+	}
+}
+
+func TestLoadTemplatesErrors(t *testing.T) {
+	cases := []struct {
+		name, file, text, wantErr string
+	}{
+		{
+			name: "unknown kind",
+			file: "node.tmpl", text: `{{define "title"}}{{end}}`,
+			wantErr: `unknown kind "node"`,
+		},
+		{
+			name: "unknown backend",
+			file: "slak.deployment.tmpl", text: `{{define "title"}}{{end}}`,
+			wantErr: `unknown backend "slak"`,
+		},
+		{
+			name: "parse error",
+			file: "deployment.tmpl", text: `{{define "title"}}{{.Deployment.JobID}{{end}}`,
+			wantErr: "error parsing template",
+		},
+		{
+			name: "misspelled field",
+			file: "deployment.tmpl", text: `{{define "title"}}{{.Deployment.JobId}}{{end}}`,
+			wantErr: "error validating template",
+		},
+		{
+			// deployment notifications have no allocation
+			name: "field of another kind",
+			file: "deployment.tmpl", text: `{{define "title"}}{{.Allocation.ID}}{{end}}`,
+			wantErr: "error validating template",
+		},
+		{
+			name: "field of another kind for one backend",
+			file: "discord.allocation.tmpl", text: `{{define "summary"}}{{.Deployment.StatusDescription}}{{end}}`,
+			wantErr: "error validating template",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplate(t, dir, c.file, c.text)
+
+			_, err := LoadTemplates(dir)
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("LoadTemplates() error = %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	got := parseFields("intro\n## First\none\ntwo\n\n## Second \nthree\n## Empty")
+	want := []Field{
+		{Value: "intro"},
+		{Title: "First", Value: "one\ntwo"},
+		{Title: "Second", Value: "three"},
+		{Title: "Empty"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseFields() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("field %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+)
+
+// webhookSchemaVersion is bumped on incompatible changes of webhookPayload,
+// fields may be added without bumping it.
+const webhookSchemaVersion = 1
+
+// headers of webhook requests
+const (
+	webhookHeaderEvent     = "X-Nomad-Notifier-Event"
+	webhookHeaderTimestamp = "X-Nomad-Notifier-Timestamp"
+	// webhookHeaderSignature is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>"
+	webhookHeaderSignature = "X-Nomad-Notifier-Signature"
+)
+
+type webhookPayload struct {
+	Version   int       `json:"version"`
+	Event     string    `json:"event"`
+	Key       string    `json:"key,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Title    string         `json:"title"`
+	Summary  string         `json:"summary,omitempty"`
+	Severity Severity       `json:"severity,omitempty"`
+	URL      string         `json:"url,omitempty"`
+	Subject  webhookSubject `json:"subject"`
+	Fields   []webhookField `json:"fields,omitempty"`
+	Links    []webhookLink  `json:"links,omitempty"`
+
+	Deployment *webhookDeployment `json:"deployment,omitempty"`
+	Allocation *webhookAllocation `json:"allocation,omitempty"`
+}
+
+type webhookSubject struct {
+	Namespace  string            `json:"namespace,omitempty"`
+	JobID      string            `json:"job_id,omitempty"`
+	TaskGroups []string          `json:"task_groups,omitempty"`
+	NodePool   string            `json:"node_pool,omitempty"`
+	JobMeta    map[string]string `json:"job_meta,omitempty"`
+}
+
+type webhookField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type webhookLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type webhookDeployment struct {
+	ID                string                          `json:"id"`
+	JobID             string                          `json:"job_id"`
+	JobVersion        uint64                          `json:"job_version"`
+	Namespace         string                          `json:"namespace"`
+	Status            string                          `json:"status"`
+	StatusDescription string                          `json:"status_description"`
+	TaskGroups        map[string]webhookTaskGroupInfo `json:"task_groups"`
+}
+
+type webhookTaskGroupInfo struct {
+	Desired         int  `json:"desired"`
+	Placed          int  `json:"placed"`
+	Healthy         int  `json:"healthy"`
+	Unhealthy       int  `json:"unhealthy"`
+	DesiredCanaries int  `json:"desired_canaries"`
+	PlacedCanaries  int  `json:"placed_canaries"`
+	Promoted        bool `json:"promoted"`
+}
+
+type webhookAllocation struct {
+	ID           string           `json:"id"`
+	JobID        string           `json:"job_id"`
+	Namespace    string           `json:"namespace"`
+	TaskGroup    string           `json:"task_group"`
+	NodeID       string           `json:"node_id"`
+	NodeName     string           `json:"node_name"`
+	ClientStatus string           `json:"client_status"`
+	Findings     []webhookFinding `json:"findings,omitempty"`
+}
+
+type webhookFinding struct {
+	Task    string        `json:"task"`
+	Kind    classify.Kind `json:"kind"`
+	Message string        `json:"message"`
+}
+
+func newWebhookBot(cfg Config, nomadAddress string) ([]Impl, error) {
+	if len(cfg.Webhook) == 0 {
+		return nil, fmt.Errorf("please set webhook url to enable webhook bot: %w", errImplNotEnabled)
+	}
+
+	var bots []Impl
+	for _, c := range cfg.Webhook {
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook %q: url is required", c.Name)
+		}
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		bots = append(bots, &webhookBot{
+			name:   c.Name,
+			url:    c.URL,
+			secret: []byte(c.Secret),
+			client: resty.New().SetTimeout(timeout).SetHeaders(c.Headers),
+			L:      slog.With("bot", "webhook", "instance", c.Name),
+		})
+	}
+
+	return bots, nil
+}
+
+// webhookBot posts every notification as JSON, receivers correlate updates by event and key.
+type webhookBot struct {
+	mu     sync.Mutex
+	name   string
+	url    string
+	secret []byte
+	client *resty.Client
+	L      *slog.Logger
+}
+
+func (b *webhookBot) Name() string {
+	return b.name
+}
+
+func (b *webhookBot) Type() string {
+	return "webhook"
+}
+
+func (b *webhookBot) Post(n Notification) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	body, err := json.Marshal(webhookPayloadFor(n, now))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req := b.client.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader(webhookHeaderEvent, n.Kind).
+		SetBody(body)
+	if len(b.secret) > 0 {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		req.SetHeader(webhookHeaderTimestamp, timestamp).
+			SetHeader(webhookHeaderSignature, "sha256="+webhookSignature(b.secret, timestamp, body))
+	}
+
+	res, err := req.Post(b.url)
+	if err != nil {
+		return "", fmt.Errorf("failed to post, err=%w", err)
+	}
+	if res.StatusCode() >= 300 {
+		return "", fmt.Errorf("failed to deliver webhook %s, code=%v", res.Body(), res.StatusCode())
+	}
+	b.L.Debug("delivered webhook", "kind", n.Kind, "key", n.Key, "code", res.StatusCode())
+
+	return "", nil
+}
+
+// webhookSignature signs the timestamp with the body, so receivers can reject replayed requests.
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookPayloadFor(n Notification, now time.Time) webhookPayload {
+	p := webhookPayload{
+		Version:   webhookSchemaVersion,
+		Event:     n.Kind,
+		Key:       n.Key,
+		Timestamp: now.UTC(),
+		Title:     n.Title,
+		Summary:   n.Summary,
+		Severity:  n.Severity,
+		URL:       n.URL,
+		Subject: webhookSubject{
+			Namespace:  n.Subject.Namespace,
+			JobID:      n.Subject.JobID,
+			TaskGroups: n.Subject.TaskGroups,
+			NodePool:   n.Subject.NodePool,
+			JobMeta:    n.Subject.JobMeta,
+		},
+	}
+	for _, f := range n.Fields {
+		p.Fields = append(p.Fields, webhookField{Title: f.Title, Value: f.Value})
+	}
+	for _, l := range n.Links {
+		p.Links = append(p.Links, webhookLink{Title: l.Title, URL: l.URL})
+	}
+
+	if n.data == nil {
+		return p
+	}
+	if d := n.data.Deployment; d != nil {
+		p.Deployment = &webhookDeployment{
+			ID:                d.ID,
+			JobID:             d.JobID,
+			JobVersion:        d.JobVersion,
+			Namespace:         d.Namespace,
+			Status:            d.Status,
+			StatusDescription: d.StatusDescription,
+			TaskGroups:        make(map[string]webhookTaskGroupInfo),
+		}
+		for name, tg := range d.TaskGroups {
+			p.Deployment.TaskGroups[name] = webhookTaskGroupInfo{
+				Desired:         tg.DesiredTotal,
+				Placed:          tg.PlacedAllocs,
+				Healthy:         tg.HealthyAllocs,
+				Unhealthy:       tg.UnhealthyAllocs,
+				DesiredCanaries: tg.DesiredCanaries,
+				PlacedCanaries:  len(tg.PlacedCanaries),
+				Promoted:        tg.Promoted,
+			}
+		}
+	}
+	if a := n.data.Allocation; a != nil {
+		p.Allocation = &webhookAllocation{
+			ID:           a.ID,
+			JobID:        a.JobID,
+			Namespace:    a.Namespace,
+			TaskGroup:    a.TaskGroup,
+			NodeID:       a.NodeID,
+			NodeName:     a.NodeName,
+			ClientStatus: a.ClientStatus,
+		}
+		for _, task := range n.data.Tasks {
+			for _, f := range task.Findings {
+				p.Allocation.Findings = append(p.Allocation.Findings, webhookFinding{Task: f.Task, Kind: f.Kind, Message: f.Message})
+			}
+		}
+	}
+	return p
+}
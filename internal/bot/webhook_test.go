@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	// printf '1700000000.{"event":"deployment"}' | openssl dgst -sha256 -hmac s3cret
+	want := "10b8a77fbccfaae9825d4aae8a8f37f7477aaae4b9336428508fae1a423277b7"
+	if got := webhookSignature([]byte("s3cret"), "1700000000", []byte(`{"event":"deployment"}`)); got != want {
+		t.Errorf("webhookSignature() = %s, want %s", got, want)
+	}
+}
+
+// webhookReceiver verifies requests the way the README tells receivers to.
+func webhookReceiver(t *testing.T, secret string, payloads chan<- webhookPayload) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Authorization = %q, want the configured header", r.Header.Get("Authorization"))
+		}
+
+		timestamp := r.Header.Get(webhookHeaderTimestamp)
+		signature := r.Header.Get(webhookHeaderSignature)
+		if secret == "" {
+			if timestamp != "" || signature != "" {
+				t.Errorf("unsigned webhook has timestamp %q and signature %q", timestamp, signature)
+			}
+		} else {
+			ts, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+				t.Errorf("invalid timestamp %q", timestamp)
+			}
+			want := "sha256=" + webhookSignature([]byte(secret), timestamp, body)
+			if !hmac.Equal([]byte(signature), []byte(want)) {
+				t.Errorf("signature = %q, want %q", signature, want)
+			}
+		}
+
+		var p webhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get(webhookHeaderEvent) != p.Event {
+			t.Errorf("event header = %q, payload event = %q", r.Header.Get(webhookHeaderEvent), p.Event)
+		}
+		payloads <- p
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestWebhookPost(t *testing.T) {
+	for _, secret := range []string{"s3cret", ""} {
+		payloads := make(chan webhookPayload, 1)
+		srv := webhookReceiver(t, secret, payloads)
+
+		impls, err := newWebhookBot(Config{Webhook: []WebhookConfig{{
+			Instance: Instance{Name: "hook"},
+			URL:      srv.URL,
+			Secret:   secret,
+			Headers:  map[string]string{"Authorization": "Bearer token"},
+		}}}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deploy := api.Deployment{
+			ID: "d1", JobID: "web", Namespace: "prod", JobVersion: 3, Status: "failed",
+			TaskGroups: map[string]*api.DeploymentState{"web": {DesiredTotal: 2, HealthyAllocs: 1, PlacedCanaries: []string{"a1"}}},
+		}
+		n := deploymentNotification(deploy, nil, "http://nomad:4646")
+		n.Title = "web deployment failed"
+		if _, err := impls[0].Post(n); err != nil {
+			t.Fatal(err)
+		}
+		srv.Close()
+
+		p := <-payloads
+		if p.Version != webhookSchemaVersion || p.Event != KindDeployment || p.Key != "d1" || p.Title != "web deployment failed" {
+			t.Errorf("payload = %+v", p)
+		}
+		if p.Subject.Namespace != "prod" || p.Subject.JobID != "web" {
+			t.Errorf("subject = %+v", p.Subject)
+		}
+		want := webhookTaskGroupInfo{Desired: 2, Healthy: 1, PlacedCanaries: 1}
+		if p.Deployment == nil || p.Deployment.JobVersion != 3 || p.Deployment.TaskGroups["web"] != want {
+			t.Errorf("deployment = %+v", p.Deployment)
+		}
+	}
+}
+
+func TestWebhookPostError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	impls, err := newWebhookBot(Config{Webhook: []WebhookConfig{{Instance: Instance{Name: "hook"}, URL: srv.URL}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impls[0].Post(Notification{Kind: KindNode}); err == nil {
+		t.Error("Post() succeeded on a server error")
+	}
+}
@@ -0,0 +1,210 @@
+// Package classify inspects the task events of allocations
+// and reports typed findings about why tasks failed.
+package classify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+type Kind string
+
+const (
+	OOMKilled        Kind = "OOMKilled"
+	NonZeroExit      Kind = "NonZeroExit"
+	RestartsExceeded Kind = "RestartsExceeded"
+	DriverFailure    Kind = "DriverFailure"
+	ImagePullFailure Kind = "ImagePullFailure"
+	KillTimeout      Kind = "KillTimeout"
+	SetupFailure     Kind = "SetupFailure"
+)
+
+// AllKinds lists every finding kind, in the order findings are reported.
+var AllKinds = []Kind{
+	OOMKilled,
+	NonZeroExit,
+	RestartsExceeded,
+	DriverFailure,
+	ImagePullFailure,
+	KillTimeout,
+	SetupFailure,
+}
+
+// DefaultKinds are the kinds reported when none are configured, only OOMKilled as before findings were typed.
+var DefaultKinds = []Kind{OOMKilled}
+
+// Finding is one reason a task failed.
+type Finding struct {
+	Kind Kind
+	Task string
+	// Message describes the finding, e.g. "exit code 1"
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Kind, f.Message)
+}
+
+// classifier inspects the events of one task.
+type classifier func(events []*api.TaskEvent) []string
+
+var classifiers = map[Kind]classifier{
+	OOMKilled:        oomKilled,
+	NonZeroExit:      nonZeroExit,
+	RestartsExceeded: restartsExceeded,
+	DriverFailure:    driverFailure,
+	ImagePullFailure: imagePullFailure,
+	KillTimeout:      killTimeout,
+	SetupFailure:     setupFailure,
+}
+
+// Classifier runs the enabled classifiers over allocations.
+type Classifier struct {
+	kinds []Kind
+}
+
+// New creates a Classifier reporting only the given kinds, DefaultKinds if none are given.
+func New(kinds ...Kind) *Classifier {
+	if len(kinds) == 0 {
+		kinds = DefaultKinds
+	}
+	return &Classifier{kinds: kinds}
+}
+
+// ParseKinds parses a comma separated list of finding kinds, e.g. "OOMKilled,NonZeroExit".
+func ParseKinds(s string) ([]Kind, error) {
+	var kinds []Kind
+	for _, item := range strings.Split(s, ",") {
+		kind := Kind(strings.TrimSpace(item))
+		if kind == "" {
+			continue
+		}
+		if _, ok := classifiers[kind]; !ok {
+			return nil, fmt.Errorf("unknown finding kind %q", kind)
+		}
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no finding kinds in %q", s)
+	}
+	return kinds, nil
+}
+
+// Classify returns the findings of all tasks of alloc, sorted by task name.
+func (c *Classifier) Classify(alloc api.Allocation) []Finding {
+	tasks := make([]string, 0, len(alloc.TaskStates))
+	for task := range alloc.TaskStates {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+
+	var findings []Finding
+	for _, task := range tasks {
+		state := alloc.TaskStates[task]
+		if state == nil {
+			continue
+		}
+		for _, kind := range c.kinds {
+			for _, msg := range classifiers[kind](state.Events) {
+				findings = append(findings, Finding{Kind: kind, Task: task, Message: msg})
+			}
+		}
+	}
+	return findings
+}
+
+func isOOM(e *api.TaskEvent) bool {
+	return e.Details["oom_killed"] == "true" || strings.Contains(e.DisplayMessage, "OOM")
+}
+
+func oomKilled(events []*api.TaskEvent) []string {
+	var msgs []string
+	for _, e := range events {
+		if isOOM(e) {
+			msgs = append(msgs, e.DisplayMessage)
+		}
+	}
+	return msgs
+}
+
+func nonZeroExit(events []*api.TaskEvent) []string {
+	var msgs []string
+	for _, e := range events {
+		if e.Type != structs.TaskTerminated || isOOM(e) {
+			continue
+		}
+		if code := e.Details["exit_code"]; code != "" && code != "0" {
+			msgs = append(msgs, fmt.Sprintf("exit code %s", code))
+		}
+	}
+	return msgs
+}
+
+func restartsExceeded(events []*api.TaskEvent) []string {
+	var msgs []string
+	for _, e := range events {
+		if e.Type == structs.TaskNotRestarting && strings.Contains(e.Details["restart_reason"], "Exceeded allowed attempts") {
+			msgs = append(msgs, e.Details["restart_reason"])
+		}
+	}
+	return msgs
+}
+
+func isImagePull(e *api.TaskEvent) bool {
+	msg := strings.ToLower(e.Details["driver_error"] + " " + e.DisplayMessage)
+	return strings.Contains(msg, "pull") || strings.Contains(msg, "image not found")
+}
+
+func driverFailure(events []*api.TaskEvent) []string {
+	var msgs []string
+	for _, e := range events {
+		if e.Type == structs.TaskDriverFailure && !isImagePull(e) {
+			msgs = append(msgs, e.DisplayMessage)
+		}
+	}
+	return msgs
+}
+
+func imagePullFailure(events []*api.TaskEvent) []string {
+	var msgs []string
+	for _, e := range events {
+		if e.Type == structs.TaskDriverFailure && isImagePull(e) {
+			msgs = append(msgs, e.DisplayMessage)
+		}
+	}
+	return msgs
+}
+
+// killTimeout finds tasks which did not stop within their kill_timeout after being asked to,
+// and were killed with SIGKILL.
+func killTimeout(events []*api.TaskEvent) []string {
+	var msgs []string
+	timeout := ""
+	for _, e := range events {
+		switch e.Type {
+		case structs.TaskKilling:
+			timeout = e.Details["kill_timeout"]
+		case structs.TaskTerminated:
+			if timeout != "" && e.Details["signal"] == "9" {
+				msgs = append(msgs, fmt.Sprintf("killed after kill_timeout %s", timeout))
+			}
+			timeout = ""
+		}
+	}
+	return msgs
+}
+
+func setupFailure(events []*api.TaskEvent) []string {
+	var msgs []string
+	for _, e := range events {
+		switch e.Type {
+		case structs.TaskSetupFailure, structs.TaskArtifactDownloadFailed, structs.TaskHookFailed, structs.TaskFailedValidation:
+			msgs = append(msgs, e.DisplayMessage)
+		}
+	}
+	return msgs
+}
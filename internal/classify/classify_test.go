@@ -0,0 +1,90 @@
+package classify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestParseKinds(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    []Kind
+		wantErr bool
+	}{
+		{in: "OOMKilled", want: []Kind{OOMKilled}},
+		{in: " OOMKilled , NonZeroExit,", want: []Kind{OOMKilled, NonZeroExit}},
+		{in: "", wantErr: true},
+		{in: ",", wantErr: true},
+		{in: " , ", wantErr: true},
+		{in: "OOMKilled,Unknown", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := ParseKinds(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseKinds(%q) error = %v, want error %v", c.in, err, c.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseKinds(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func alloc(tasks map[string][]*api.TaskEvent) api.Allocation {
+	states := make(map[string]*api.TaskState)
+	for task, events := range tasks {
+		states[task] = &api.TaskState{Events: events}
+	}
+	return api.Allocation{TaskStates: states}
+}
+
+func TestClassify(t *testing.T) {
+	a := alloc(map[string][]*api.TaskEvent{
+		"web": {
+			{Type: structs.TaskTerminated, DisplayMessage: "OOM Killed", Details: map[string]string{"oom_killed": "true", "exit_code": "137"}},
+			{Type: structs.TaskTerminated, Details: map[string]string{"exit_code": "1"}},
+			{Type: structs.TaskNotRestarting, Details: map[string]string{"restart_reason": "Exceeded allowed attempts 2 in interval 30m0s"}},
+		},
+		"db": {
+			{Type: structs.TaskDriverFailure, DisplayMessage: "Failed to pull `redis:nope`", Details: map[string]string{"driver_error": "failed to pull image"}},
+			{Type: structs.TaskDriverFailure, DisplayMessage: "failed to create container"},
+		},
+		"sidecar": {
+			{Type: structs.TaskKilling, Details: map[string]string{"kill_timeout": "5s"}},
+			{Type: structs.TaskTerminated, Details: map[string]string{"signal": "9", "exit_code": "0"}},
+			{Type: structs.TaskArtifactDownloadFailed, DisplayMessage: "artifact download failed"},
+		},
+	})
+
+	got := New(AllKinds...).Classify(a)
+	want := []Finding{
+		{Kind: DriverFailure, Task: "db", Message: "failed to create container"},
+		{Kind: ImagePullFailure, Task: "db", Message: "Failed to pull `redis:nope`"},
+		{Kind: KillTimeout, Task: "sidecar", Message: "killed after kill_timeout 5s"},
+		{Kind: SetupFailure, Task: "sidecar", Message: "artifact download failed"},
+		{Kind: OOMKilled, Task: "web", Message: "OOM Killed"},
+		{Kind: NonZeroExit, Task: "web", Message: "exit code 1"},
+		{Kind: RestartsExceeded, Task: "web", Message: "Exceeded allowed attempts 2 in interval 30m0s"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Classify() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestClassifyDefaultKinds(t *testing.T) {
+	a := alloc(map[string][]*api.TaskEvent{
+		"web": {
+			{Type: structs.TaskTerminated, DisplayMessage: "OOM Killed", Details: map[string]string{"oom_killed": "true"}},
+			{Type: structs.TaskTerminated, Details: map[string]string{"exit_code": "1"}},
+		},
+	})
+
+	got := New().Classify(a)
+	want := []Finding{{Kind: OOMKilled, Task: "web", Message: "OOM Killed"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Classify() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,590 @@
+// Package config reads the notifier configuration from an HCL file, or from env vars if no file is given.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/ttys3/nomad-event-notifier/internal/bot"
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+	"github.com/ttys3/nomad-event-notifier/internal/stream"
+)
+
+// Config is the root of the configuration file, e.g.
+//
+//	nomad {
+//	  address      = "http://127.0.0.1:4646"
+//	  external_url = "https://nomad.example.com"
+//	}
+//
+//	stream {
+//	  topics = ["Deployment:*", "Allocation:*"]
+//	}
+//
+//	slack "ops" {
+//	  token   = "xoxb-..."
+//	  channel = "C0123456789"
+//	}
+type Config struct {
+	// DataDir keeps the last processed event index and the bolt message store
+	DataDir string `hcl:"data_dir,optional"`
+	// HTTPAddr serves /debug/vars and the endpoints of backends, e.g. ":8080"
+	HTTPAddr string `hcl:"http_addr,optional"`
+
+	DeployMessageGrace string   `hcl:"deploy_message_grace,optional"`
+	AllocMessageTTL    string   `hcl:"alloc_message_ttl,optional"`
+	AllocFindings      []string `hcl:"alloc_findings,optional"`
+
+	Nomad        *Nomad        `hcl:"nomad,block"`
+	Stream       *Stream       `hcl:"stream,block"`
+	MessageStore *MessageStore `hcl:"message_store,block"`
+	Templates    *Templates    `hcl:"templates,block"`
+
+	Slack   []*Slack   `hcl:"slack,block"`
+	Discord []*Discord `hcl:"discord,block"`
+	Teams   []*Teams   `hcl:"teams,block"`
+
+	Mattermost []*Mattermost `hcl:"mattermost,block"`
+	Telegram   []*Telegram   `hcl:"telegram,block"`
+	Webhook    []*Webhook    `hcl:"webhook,block"`
+	SMTP       []*SMTP       `hcl:"smtp,block"`
+	PagerDuty  []*PagerDuty  `hcl:"pagerduty,block"`
+	Opsgenie   []*Opsgenie   `hcl:"opsgenie,block"`
+	Matrix     []*Matrix     `hcl:"matrix,block"`
+	GoogleChat []*GoogleChat `hcl:"google_chat,block"`
+
+	Routes       []*Route      `hcl:"route,block"`
+	DefaultRoute *DefaultRoute `hcl:"default_route,block"`
+
+	// set by validate
+	deployGrace time.Duration
+	allocTTL    time.Duration
+	classifier  *classify.Classifier
+	templates   *bot.Templates
+}
+
+// Nomad overrides the NOMAD_* env vars of the nomad api client.
+type Nomad struct {
+	Address   string `hcl:"address,optional"`
+	Token     string `hcl:"token,optional"`
+	Region    string `hcl:"region,optional"`
+	Namespace string `hcl:"namespace,optional"`
+	// ExternalURL is the nomad address links in messages point to, defaults to Address
+	ExternalURL string `hcl:"external_url,optional"`
+}
+
+type Stream struct {
+	// Topics are "Topic:FilterKey" pairs, e.g. ["Deployment:*", "Job:web"]
+	Topics      []string `hcl:"topics,optional"`
+	Namespace   string   `hcl:"namespace,optional"`
+	MaxLookback string   `hcl:"max_lookback,optional"`
+
+	// set by validate
+	topics      map[api.Topic][]string
+	maxLookback time.Duration
+}
+
+type MessageStore struct {
+	// Type is "memory", "bolt" or "nomad", defaults to bolt if data_dir is set, memory otherwise
+	Type           string `hcl:"type,optional"`
+	MaxAllocations int    `hcl:"max_allocations,optional"`
+	NomadPrefix    string `hcl:"nomad_prefix,optional"`
+	NomadNamespace string `hcl:"nomad_namespace,optional"`
+}
+
+type Templates struct {
+	Dir string `hcl:"dir"`
+}
+
+// Slack is a slack instance, the label names it, e.g. slack "ops" {}.
+type Slack struct {
+	Name string `hcl:"name,label"`
+	// Kinds limits the notification kinds sent, e.g. ["deployment", "allocation"], all if empty
+	Kinds         []string `hcl:"kinds,optional"`
+	Token         string   `hcl:"token"`
+	Channel       string   `hcl:"channel"`
+	SigningSecret string   `hcl:"signing_secret,optional"`
+}
+
+type Discord struct {
+	Name       string   `hcl:"name,label"`
+	Kinds      []string `hcl:"kinds,optional"`
+	WebhookURL string   `hcl:"webhook_url"`
+}
+
+type Teams struct {
+	Name       string   `hcl:"name,label"`
+	Kinds      []string `hcl:"kinds,optional"`
+	WebhookURL string   `hcl:"webhook_url"`
+}
+
+type Mattermost struct {
+	Name      string   `hcl:"name,label"`
+	Kinds     []string `hcl:"kinds,optional"`
+	URL       string   `hcl:"url"`
+	Token     string   `hcl:"token"`
+	ChannelID string   `hcl:"channel_id"`
+}
+
+type Telegram struct {
+	Name   string   `hcl:"name,label"`
+	Kinds  []string `hcl:"kinds,optional"`
+	Token  string   `hcl:"token"`
+	ChatID string   `hcl:"chat_id"`
+	// ParseMode is "HTML" or "MarkdownV2", defaults to HTML
+	ParseMode string `hcl:"parse_mode,optional"`
+	APIURL    string `hcl:"api_url,optional"`
+}
+
+type Webhook struct {
+	Name    string            `hcl:"name,label"`
+	Kinds   []string          `hcl:"kinds,optional"`
+	URL     string            `hcl:"url"`
+	Secret  string            `hcl:"secret,optional"`
+	Headers map[string]string `hcl:"headers,optional"`
+	Timeout string            `hcl:"timeout,optional"`
+
+	// set by validate
+	timeout time.Duration
+}
+
+// SMTP mails failed deployments and allocation failures to to and the recipients matching them, e.g.
+//
+//	smtp "oncall" {
+//	  host = "smtp.example.com"
+//	  from = "nomad@example.com"
+//	  to   = ["ops@example.com"]
+//
+//	  recipient "payments@example.com" {
+//	    job_ids = ["payments-*"]
+//	  }
+//	}
+type SMTP struct {
+	Name               string       `hcl:"name,label"`
+	Kinds              []string     `hcl:"kinds,optional"`
+	Host               string       `hcl:"host"`
+	Port               int          `hcl:"port,optional"`
+	TLS                string       `hcl:"tls,optional"`
+	TLSCAFile          string       `hcl:"tls_ca_file,optional"`
+	InsecureSkipVerify bool         `hcl:"insecure_skip_verify,optional"`
+	Username           string       `hcl:"username,optional"`
+	Password           string       `hcl:"password,optional"`
+	From               string       `hcl:"from"`
+	To                 []string     `hcl:"to,optional"`
+	Digest             string       `hcl:"digest,optional"`
+	Recipients         []*Recipient `hcl:"recipient,block"`
+
+	// set by validate
+	digest time.Duration
+}
+
+type PagerDuty struct {
+	Name       string   `hcl:"name,label"`
+	Kinds      []string `hcl:"kinds,optional"`
+	RoutingKey string   `hcl:"routing_key"`
+	APIURL     string   `hcl:"api_url,optional"`
+}
+
+type Opsgenie struct {
+	Name   string   `hcl:"name,label"`
+	Kinds  []string `hcl:"kinds,optional"`
+	APIKey string   `hcl:"api_key"`
+	APIURL string   `hcl:"api_url,optional"`
+	// Priorities by notification kind, e.g. { deployment = "P1" }
+	Priorities map[string]string `hcl:"priorities,optional"`
+}
+
+type Matrix struct {
+	Name          string   `hcl:"name,label"`
+	Kinds         []string `hcl:"kinds,optional"`
+	HomeserverURL string   `hcl:"homeserver_url"`
+	AccessToken   string   `hcl:"access_token"`
+	RoomID        string   `hcl:"room_id"`
+}
+
+type GoogleChat struct {
+	Name       string   `hcl:"name,label"`
+	Kinds      []string `hcl:"kinds,optional"`
+	WebhookURL string   `hcl:"webhook_url"`
+}
+
+// Recipient gets the mails matching all of its conditions, they are the ones of a route.
+type Recipient struct {
+	Address    string            `hcl:"address,label"`
+	Namespaces []string          `hcl:"namespaces,optional"`
+	JobIDs     []string          `hcl:"job_ids,optional"`
+	TaskGroups []string          `hcl:"task_groups,optional"`
+	NodePools  []string          `hcl:"node_pools,optional"`
+	Meta       map[string]string `hcl:"meta,optional"`
+	Filter     string            `hcl:"filter,optional"`
+}
+
+// Route sends matching notifications to the backend instances in targets, e.g.
+//
+//	route "payments" {
+//	  namespaces = ["prod"]
+//	  meta       = { notify_channel = "#payments" }
+//	  targets    = ["payments"]
+//	}
+//
+// Routes are evaluated in order, the first matching one wins unless it sets continue.
+type Route struct {
+	Name       string            `hcl:"name,label"`
+	Namespaces []string          `hcl:"namespaces,optional"`
+	JobIDs     []string          `hcl:"job_ids,optional"`
+	TaskGroups []string          `hcl:"task_groups,optional"`
+	NodePools  []string          `hcl:"node_pools,optional"`
+	Meta       map[string]string `hcl:"meta,optional"`
+	// Filter is a go-bexpr expression evaluated on the event payload
+	Filter   string   `hcl:"filter,optional"`
+	Targets  []string `hcl:"targets"`
+	Continue bool     `hcl:"continue,optional"`
+}
+
+// DefaultRoute gets the notifications matching no route, all instances do if it is not set.
+type DefaultRoute struct {
+	Targets []string `hcl:"targets"`
+}
+
+// Load reads and validates the configuration file at path.
+// The returned error lists every problem found, each with the position of the offending block or attribute.
+func Load(path string) (*Config, error) {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile(path)
+	if diags.HasErrors() {
+		return nil, diagnosticsError(diags)
+	}
+
+	cfg := &Config{}
+	if diags := gohcl.DecodeBody(file.Body, nil, cfg); diags.HasErrors() {
+		return nil, diagnosticsError(diags)
+	}
+
+	body, _ := file.Body.(*hclsyntax.Body)
+	if diags := cfg.validate(body); diags.HasErrors() {
+		return nil, diagnosticsError(diags)
+	}
+	return cfg, nil
+}
+
+// FromEnv builds the configuration from the env vars used before configuration files were supported.
+func FromEnv() (*Config, error) {
+	cfg := &Config{
+		DataDir:            os.Getenv("DATA_DIR"),
+		HTTPAddr:           os.Getenv("HTTP_ADDR"),
+		DeployMessageGrace: os.Getenv("DEPLOY_MESSAGE_GRACE"),
+		AllocMessageTTL:    os.Getenv("ALLOC_MESSAGE_TTL"),
+		AllocFindings:      splitEnv("ALLOC_FINDINGS"),
+		Nomad: &Nomad{
+			ExternalURL: os.Getenv("NOMAD_SERVER_EXTERNAL_URL"),
+		},
+		Stream: &Stream{
+			Topics:      splitEnv("EVENT_TOPICS"),
+			Namespace:   os.Getenv("EVENT_NAMESPACE"),
+			MaxLookback: os.Getenv("EVENT_MAX_LOOKBACK"),
+		},
+		MessageStore: &MessageStore{
+			Type:           os.Getenv("MESSAGE_STORE"),
+			NomadPrefix:    os.Getenv("MESSAGE_STORE_NOMAD_PREFIX"),
+			NomadNamespace: os.Getenv("MESSAGE_STORE_NOMAD_NAMESPACE"),
+		},
+	}
+	if v := os.Getenv("MESSAGE_STORE_MAX_ALLOCATIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MESSAGE_STORE_MAX_ALLOCATIONS %q: %w", v, err)
+		}
+		cfg.MessageStore.MaxAllocations = n
+	}
+	if dir := os.Getenv("TEMPLATE_DIR"); dir != "" {
+		cfg.Templates = &Templates{Dir: dir}
+	}
+	if token, channel := os.Getenv("SLACK_TOKEN"), os.Getenv("SLACK_CHANNEL"); token != "" && channel != "" {
+		cfg.Slack = append(cfg.Slack, &Slack{
+			Name:          "slack",
+			Token:         token,
+			Channel:       channel,
+			SigningSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+		})
+	}
+	if url := os.Getenv("DISCORD_WEBHOOK_URL"); url != "" {
+		cfg.Discord = append(cfg.Discord, &Discord{Name: "discord", WebhookURL: url})
+	}
+	if url := os.Getenv("TEAMS_WEBHOOK_URL"); url != "" {
+		cfg.Teams = append(cfg.Teams, &Teams{Name: "teams", WebhookURL: url})
+	}
+	if token := os.Getenv("TELEGRAM_TOKEN"); token != "" {
+		cfg.Telegram = append(cfg.Telegram, &Telegram{
+			Name:      "telegram",
+			Token:     token,
+			ChatID:    os.Getenv("TELEGRAM_CHAT_ID"),
+			ParseMode: os.Getenv("TELEGRAM_PARSE_MODE"),
+		})
+	}
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		cfg.Webhook = append(cfg.Webhook, &Webhook{Name: "webhook", URL: url, Secret: os.Getenv("WEBHOOK_SECRET")})
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := 0
+		if v := os.Getenv("SMTP_PORT"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_PORT %q: %w", v, err)
+			}
+			port = n
+		}
+		insecure := false
+		if v := os.Getenv("SMTP_INSECURE_SKIP_VERIFY"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_INSECURE_SKIP_VERIFY %q: %w", v, err)
+			}
+			insecure = b
+		}
+		cfg.SMTP = append(cfg.SMTP, &SMTP{
+			Name:               "smtp",
+			Host:               host,
+			Port:               port,
+			TLS:                os.Getenv("SMTP_TLS"),
+			TLSCAFile:          os.Getenv("SMTP_TLS_CA_FILE"),
+			InsecureSkipVerify: insecure,
+			Username:           os.Getenv("SMTP_USERNAME"),
+			Password:           os.Getenv("SMTP_PASSWORD"),
+			From:               os.Getenv("SMTP_FROM"),
+			To:                 splitEnv("SMTP_TO"),
+			Digest:             os.Getenv("SMTP_DIGEST"),
+		})
+	}
+	if key := os.Getenv("PAGERDUTY_ROUTING_KEY"); key != "" {
+		cfg.PagerDuty = append(cfg.PagerDuty, &PagerDuty{Name: "pagerduty", RoutingKey: key, APIURL: os.Getenv("PAGERDUTY_API_URL")})
+	}
+	if key := os.Getenv("OPSGENIE_API_KEY"); key != "" {
+		cfg.Opsgenie = append(cfg.Opsgenie, &Opsgenie{Name: "opsgenie", APIKey: key, APIURL: os.Getenv("OPSGENIE_API_URL")})
+	}
+	if url := os.Getenv("MATRIX_HOMESERVER_URL"); url != "" {
+		cfg.Matrix = append(cfg.Matrix, &Matrix{
+			Name:          "matrix",
+			HomeserverURL: url,
+			AccessToken:   os.Getenv("MATRIX_ACCESS_TOKEN"),
+			RoomID:        os.Getenv("MATRIX_ROOM_ID"),
+		})
+	}
+	if url := os.Getenv("GOOGLE_CHAT_WEBHOOK_URL"); url != "" {
+		cfg.GoogleChat = append(cfg.GoogleChat, &GoogleChat{Name: "google_chat", WebhookURL: url})
+	}
+	if url := os.Getenv("MATTERMOST_URL"); url != "" {
+		cfg.Mattermost = append(cfg.Mattermost, &Mattermost{
+			Name:      "mattermost",
+			URL:       url,
+			Token:     os.Getenv("MATTERMOST_TOKEN"),
+			ChannelID: os.Getenv("MATTERMOST_CHANNEL_ID"),
+		})
+	}
+
+	if diags := cfg.validate(nil); diags.HasErrors() {
+		return nil, diagnosticsError(diags)
+	}
+	return cfg, nil
+}
+
+func splitEnv(name string) []string {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// NomadConfig returns the nomad api client configuration, NOMAD_* env vars apply unless overridden.
+func (c *Config) NomadConfig() *api.Config {
+	config := api.DefaultConfig()
+	if c.Nomad.Address != "" {
+		config.Address = c.Nomad.Address
+	}
+	if c.Nomad.Token != "" {
+		config.SecretID = c.Nomad.Token
+	}
+	if c.Nomad.Region != "" {
+		config.Region = c.Nomad.Region
+	}
+	if c.Nomad.Namespace != "" {
+		config.Namespace = c.Nomad.Namespace
+	}
+	return config
+}
+
+// ExternalURL is the nomad address links in messages point to.
+func (c *Config) ExternalURL(config *api.Config) string {
+	if c.Nomad.ExternalURL != "" {
+		return c.Nomad.ExternalURL
+	}
+	return config.Address
+}
+
+func (c *Config) StreamConfig() stream.Config {
+	return stream.Config{
+		Topics:      c.Stream.topics,
+		Namespace:   c.Stream.Namespace,
+		MaxLookback: c.Stream.maxLookback,
+	}
+}
+
+// BotConfig returns the bot configuration, without the nomad client and message store.
+func (c *Config) BotConfig() bot.Config {
+	cfg := bot.Config{
+		Classifier:  c.classifier,
+		Templates:   c.templates,
+		DeployGrace: c.deployGrace,
+		AllocTTL:    c.allocTTL,
+	}
+	for _, s := range c.Slack {
+		cfg.Slack = append(cfg.Slack, bot.SlackConfig{
+			Instance:      bot.Instance{Name: s.Name, Kinds: s.Kinds},
+			Token:         s.Token,
+			Channel:       s.Channel,
+			SigningSecret: s.SigningSecret,
+		})
+	}
+	for _, d := range c.Discord {
+		cfg.Discord = append(cfg.Discord, bot.DiscordConfig{
+			Instance:   bot.Instance{Name: d.Name, Kinds: d.Kinds},
+			WebhookURL: d.WebhookURL,
+		})
+	}
+	for _, t := range c.Teams {
+		cfg.Teams = append(cfg.Teams, bot.TeamsConfig{
+			Instance:   bot.Instance{Name: t.Name, Kinds: t.Kinds},
+			WebhookURL: t.WebhookURL,
+		})
+	}
+	for _, m := range c.Mattermost {
+		cfg.Mattermost = append(cfg.Mattermost, bot.MattermostConfig{
+			Instance:  bot.Instance{Name: m.Name, Kinds: m.Kinds},
+			URL:       m.URL,
+			Token:     m.Token,
+			ChannelID: m.ChannelID,
+		})
+	}
+	for _, t := range c.Telegram {
+		cfg.Telegram = append(cfg.Telegram, bot.TelegramConfig{
+			Instance:  bot.Instance{Name: t.Name, Kinds: t.Kinds},
+			Token:     t.Token,
+			ChatID:    t.ChatID,
+			ParseMode: t.ParseMode,
+			APIURL:    t.APIURL,
+		})
+	}
+	for _, w := range c.Webhook {
+		cfg.Webhook = append(cfg.Webhook, bot.WebhookConfig{
+			Instance: bot.Instance{Name: w.Name, Kinds: w.Kinds},
+			URL:      w.URL,
+			Secret:   w.Secret,
+			Headers:  w.Headers,
+			Timeout:  w.timeout,
+		})
+	}
+	for _, m := range c.SMTP {
+		smtpCfg := bot.SMTPConfig{
+			Instance:           bot.Instance{Name: m.Name, Kinds: m.Kinds},
+			Host:               m.Host,
+			Port:               m.Port,
+			TLS:                m.TLS,
+			TLSCAFile:          m.TLSCAFile,
+			InsecureSkipVerify: m.InsecureSkipVerify,
+			Username:           m.Username,
+			Password:           m.Password,
+			From:               m.From,
+			To:                 m.To,
+			Digest:             m.digest,
+		}
+		for _, r := range m.Recipients {
+			smtpCfg.Recipients = append(smtpCfg.Recipients, bot.SMTPRecipient{
+				Address: r.Address,
+				Match: bot.Route{
+					Name:       r.Address,
+					Namespaces: r.Namespaces,
+					JobIDs:     r.JobIDs,
+					TaskGroups: r.TaskGroups,
+					NodePools:  r.NodePools,
+					Meta:       r.Meta,
+					Filter:     r.Filter,
+				},
+			})
+		}
+		cfg.SMTP = append(cfg.SMTP, smtpCfg)
+	}
+	for _, p := range c.PagerDuty {
+		cfg.PagerDuty = append(cfg.PagerDuty, bot.PagerDutyConfig{
+			Instance:   bot.Instance{Name: p.Name, Kinds: p.Kinds},
+			RoutingKey: p.RoutingKey,
+			APIURL:     p.APIURL,
+		})
+	}
+	for _, o := range c.Opsgenie {
+		cfg.Opsgenie = append(cfg.Opsgenie, bot.OpsgenieConfig{
+			Instance:   bot.Instance{Name: o.Name, Kinds: o.Kinds},
+			APIKey:     o.APIKey,
+			APIURL:     o.APIURL,
+			Priorities: o.Priorities,
+		})
+	}
+	for _, m := range c.Matrix {
+		cfg.Matrix = append(cfg.Matrix, bot.MatrixConfig{
+			Instance:      bot.Instance{Name: m.Name, Kinds: m.Kinds},
+			HomeserverURL: m.HomeserverURL,
+			AccessToken:   m.AccessToken,
+			RoomID:        m.RoomID,
+		})
+	}
+	for _, g := range c.GoogleChat {
+		cfg.GoogleChat = append(cfg.GoogleChat, bot.GoogleChatConfig{
+			Instance:   bot.Instance{Name: g.Name, Kinds: g.Kinds},
+			WebhookURL: g.WebhookURL,
+		})
+	}
+	for _, r := range c.Routes {
+		cfg.Routes = append(cfg.Routes, bot.Route{
+			Name:       r.Name,
+			Namespaces: r.Namespaces,
+			JobIDs:     r.JobIDs,
+			TaskGroups: r.TaskGroups,
+			NodePools:  r.NodePools,
+			Meta:       r.Meta,
+			Filter:     r.Filter,
+			Targets:    r.Targets,
+			Continue:   r.Continue,
+		})
+	}
+	if c.DefaultRoute != nil {
+		cfg.DefaultTargets = c.DefaultRoute.Targets
+	}
+	return cfg
+}
+
+// diagnosticsError lists all diagnostics one per line, unlike hcl.Diagnostics.Error which only shows the first.
+func diagnosticsError(diags hcl.Diagnostics) error {
+	lines := make([]string, 0, len(diags))
+	for _, d := range diags {
+		if d.Severity != hcl.DiagError {
+			continue
+		}
+		line := d.Summary
+		if d.Detail != "" {
+			line += ": " + d.Detail
+		}
+		if d.Subject != nil {
+			line = d.Subject.String() + ": " + line
+		}
+		lines = append(lines, line)
+	}
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(lines, "\n  "))
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load writes text to a configuration file and loads it.
+func load(t *testing.T, text string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoadMaxLookback(t *testing.T) {
+	cases := []struct {
+		name    string
+		text    string
+		want    time.Duration
+		wantErr string
+	}{
+		{name: "default", text: ``, want: 10 * time.Minute},
+		{name: "set", text: `stream { max_lookback = "1h" }`, want: time.Hour},
+		{name: "no limit", text: `stream { max_lookback = "0" }`, want: 0},
+		{name: "negative", text: `stream { max_lookback = "-1m" }`, wantErr: "must not be negative"},
+		{name: "invalid", text: `stream { max_lookback = "soon" }`, wantErr: "Invalid stream.max_lookback"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := load(t, c.text)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.StreamConfig().MaxLookback; got != c.want {
+				t.Errorf("MaxLookback = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadPositiveDurations(t *testing.T) {
+	for _, attr := range []string{"deploy_message_grace", "alloc_message_ttl"} {
+		for _, value := range []string{"0", "-1h"} {
+			_, err := load(t, attr+` = "`+value+`"`)
+			if err == nil || !strings.Contains(err.Error(), "Invalid "+attr) {
+				t.Errorf("Load() with %s = %q: error = %v, want invalid %s", attr, value, err, attr)
+			}
+		}
+	}
+}
+
+func TestLoadReportsPosition(t *testing.T) {
+	_, err := load(t, "stream {\n  max_lookback = \"-1m\"\n}\n")
+	if err == nil || !strings.Contains(err.Error(), "config.hcl:2,") {
+		t.Errorf("Load() error = %v, want the position of max_lookback", err)
+	}
+}
+
+func TestLoadInstanceNames(t *testing.T) {
+	cases := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			text: `
+discord "team-a_1" { webhook_url = "https://discord.example/a" }
+discord "team-b" { webhook_url = "https://discord.example/b" }`,
+		},
+		{
+			name:    "invalid characters",
+			text:    `discord "team a/b" { webhook_url = "https://discord.example/a" }`,
+			wantErr: `invalid name "team a/b"`,
+		},
+		{
+			name:    "empty",
+			text:    `discord "" { webhook_url = "https://discord.example/a" }`,
+			wantErr: `invalid name ""`,
+		},
+		{
+			name: "duplicate of the same type",
+			text: `
+discord "team" { webhook_url = "https://discord.example/a" }
+discord "team" { webhook_url = "https://discord.example/b" }`,
+			wantErr: `duplicate discord block "team"`,
+		},
+		{
+			name: "duplicate of another type",
+			text: `
+discord "team" { webhook_url = "https://discord.example/a" }
+teams "team" { webhook_url = "https://teams.example/b" }`,
+			wantErr: `name "team" is already used by a discord block`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := load(t, c.text)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSMTPTLSCAFile(t *testing.T) {
+	smtp := func(attrs string) string {
+		return `smtp "mail" {
+  host = "smtp.example.com"
+  from = "nomad@example.com"
+  to   = ["ops@example.com"]
+  ` + attrs + `
+}`
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("-"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := load(t, smtp(`tls_ca_file = "`+caFile+`"
+  insecure_skip_verify = true`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cfg.BotConfig().SMTP[0]; c.TLSCAFile != caFile || !c.InsecureSkipVerify {
+		t.Errorf("SMTP = %+v", c)
+	}
+
+	if _, err := load(t, smtp(`tls_ca_file = "/nonexistent/ca.pem"`)); err == nil || !strings.Contains(err.Error(), "Invalid smtp \"mail\".tls_ca_file") {
+		t.Errorf("Load() with a missing tls_ca_file: error = %v", err)
+	}
+	if _, err := load(t, smtp(`tls = "none"
+  tls_ca_file = "`+caFile+`"`)); err == nil || !strings.Contains(err.Error(), "is not used") {
+		t.Errorf("Load() with tls_ca_file and tls none: error = %v", err)
+	}
+}
@@ -0,0 +1,413 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-bexpr"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/ttys3/nomad-event-notifier/internal/bot"
+	"github.com/ttys3/nomad-event-notifier/internal/classify"
+	"github.com/ttys3/nomad-event-notifier/internal/stream"
+)
+
+// validator collects the problems of a configuration, pointing each at its block or attribute in body.
+type validator struct {
+	// body is nil if the configuration does not come from a native HCL file
+	body  *hclsyntax.Body
+	diags hcl.Diagnostics
+}
+
+// at is the position of attr in the last top-level block of blockType with the label,
+// or of the block itself if the attribute is not set. The last block is the offending one for duplicate labels.
+// An empty blockType refers to top-level attributes.
+func (v *validator) at(blockType, label, attr string) *hcl.Range {
+	if v.body == nil {
+		return nil
+	}
+
+	body := v.body
+	var blockRange *hcl.Range
+	if blockType != "" {
+		body = nil
+		for _, b := range v.body.Blocks {
+			if b.Type != blockType || (label != "" && (len(b.Labels) == 0 || b.Labels[0] != label)) {
+				continue
+			}
+			r := b.DefRange()
+			blockRange = &r
+			body = b.Body
+		}
+	}
+
+	if body != nil && attr != "" {
+		if a, ok := body.Attributes[attr]; ok {
+			return a.SrcRange.Ptr()
+		}
+	}
+	return blockRange
+}
+
+// errorf reports a problem of attr in the block, e.g. errorf("stream", "", "max_lookback", ...).
+func (v *validator) errorf(blockType, label, attr, format string, args ...any) {
+	where := attr
+	if blockType != "" {
+		where = blockType
+		if label != "" {
+			where += fmt.Sprintf(" %q", label)
+		}
+		if attr != "" {
+			where += "." + attr
+		}
+	}
+	v.diags = append(v.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid " + where,
+		Detail:   fmt.Sprintf(format, args...),
+		Subject:  v.at(blockType, label, attr),
+	})
+}
+
+// duration parses value, def if it is empty. Zero is only valid with allowZero, e.g. when it means no limit.
+func (v *validator) duration(blockType, attr, value string, def time.Duration, allowZero bool) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		v.errorf(blockType, "", attr, "%s", err)
+		return def
+	}
+	switch {
+	case d < 0:
+		v.errorf(blockType, "", attr, "must not be negative, got %s", value)
+		return def
+	case d == 0 && !allowZero:
+		v.errorf(blockType, "", attr, "must be positive, got %s", value)
+		return def
+	}
+	return d
+}
+
+// validate checks the configuration, sets the defaults of omitted blocks and parses values
+// used by BotConfig and StreamConfig.
+func (c *Config) validate(body *hclsyntax.Body) hcl.Diagnostics {
+	v := &validator{body: body}
+
+	if c.Nomad == nil {
+		c.Nomad = &Nomad{}
+	}
+	if c.Stream == nil {
+		c.Stream = &Stream{}
+	}
+	if c.MessageStore == nil {
+		c.MessageStore = &MessageStore{}
+	}
+
+	c.deployGrace = v.duration("", "deploy_message_grace", c.DeployMessageGrace, time.Hour, false)
+	c.allocTTL = v.duration("", "alloc_message_ttl", c.AllocMessageTTL, 24*time.Hour, false)
+
+	c.classifier = classify.New()
+	if c.AllocFindings != nil {
+		kinds, err := classify.ParseKinds(strings.Join(c.AllocFindings, ","))
+		if err != nil {
+			v.errorf("", "", "alloc_findings", "%s, supported are %s", err, joinKinds(classify.AllKinds))
+		}
+		c.classifier = classify.New(kinds...)
+	}
+
+	if len(c.Stream.Topics) > 0 {
+		topics, err := stream.ParseTopics(strings.Join(c.Stream.Topics, ","))
+		if err != nil {
+			v.errorf("stream", "", "topics", "%s", err)
+		}
+		c.Stream.topics = topics
+	}
+	c.Stream.maxLookback = v.duration("stream", "max_lookback", c.Stream.MaxLookback, 10*time.Minute, true)
+
+	c.validateMessageStore(v)
+
+	if c.Templates != nil {
+		templates, err := bot.LoadTemplates(c.Templates.Dir)
+		if err != nil {
+			v.errorf("templates", "", "dir", "%s", err)
+		}
+		c.templates = templates
+	}
+
+	names := c.validateBackends(v)
+	c.validateRoutes(v, names)
+
+	return v.diags
+}
+
+func (c *Config) validateMessageStore(v *validator) {
+	s := c.MessageStore
+	if s.Type == "" {
+		s.Type = "memory"
+		if c.DataDir != "" {
+			s.Type = "bolt"
+		}
+	}
+	if s.MaxAllocations == 0 {
+		s.MaxAllocations = 1000
+	}
+	if s.NomadPrefix == "" {
+		s.NomadPrefix = "nomad-event-notifier/messages"
+	}
+
+	switch s.Type {
+	case "memory", "nomad":
+	case "bolt":
+		if c.DataDir == "" {
+			v.errorf("message_store", "", "type", "data_dir is required for the bolt message store")
+		}
+	default:
+		v.errorf("message_store", "", "type", "unknown message store %q, supported are memory, bolt and nomad", s.Type)
+	}
+	if s.MaxAllocations < 0 {
+		v.errorf("message_store", "", "max_allocations", "must not be negative")
+	}
+}
+
+// instanceNameRe matches valid instance names, they are used in message store keys and URL paths.
+var instanceNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validateBackends returns the block types of the instances by name.
+func (c *Config) validateBackends(v *validator) map[string]string {
+	names := make(map[string]string)
+	instance := func(blockType, name string, kinds []string) {
+		if !instanceNameRe.MatchString(name) {
+			v.errorf(blockType, name, "", "invalid name %q, names may only contain letters, digits, _ and -", name)
+		}
+		if other, ok := names[name]; ok {
+			if other == blockType {
+				v.errorf(blockType, name, "", "duplicate %s block %q, names must be unique", blockType, name)
+			} else {
+				v.errorf(blockType, name, "", "name %q is already used by a %s block", name, other)
+			}
+		}
+		names[name] = blockType
+		for _, kind := range kinds {
+			if !knownKinds[kind] {
+				v.errorf(blockType, name, "kinds", "unknown notification kind %q, supported are %s",
+					kind, strings.Join(sortedKinds(), ", "))
+			}
+		}
+	}
+
+	for _, s := range c.Slack {
+		instance("slack", s.Name, s.Kinds)
+		if s.Token == "" {
+			v.errorf("slack", s.Name, "token", "must not be empty")
+		}
+		if s.Channel == "" {
+			v.errorf("slack", s.Name, "channel", "must not be empty")
+		}
+	}
+	for _, d := range c.Discord {
+		instance("discord", d.Name, d.Kinds)
+		if d.WebhookURL == "" {
+			v.errorf("discord", d.Name, "webhook_url", "must not be empty")
+		}
+	}
+	for _, t := range c.Teams {
+		instance("teams", t.Name, t.Kinds)
+		if t.WebhookURL == "" {
+			v.errorf("teams", t.Name, "webhook_url", "must not be empty")
+		}
+	}
+	for _, m := range c.Mattermost {
+		instance("mattermost", m.Name, m.Kinds)
+		if m.URL == "" {
+			v.errorf("mattermost", m.Name, "url", "must not be empty")
+		}
+		if m.Token == "" {
+			v.errorf("mattermost", m.Name, "token", "must not be empty")
+		}
+		if m.ChannelID == "" {
+			v.errorf("mattermost", m.Name, "channel_id", "must not be empty")
+		}
+	}
+	for _, t := range c.Telegram {
+		instance("telegram", t.Name, t.Kinds)
+		if t.Token == "" {
+			v.errorf("telegram", t.Name, "token", "must not be empty")
+		}
+		if t.ChatID == "" {
+			v.errorf("telegram", t.Name, "chat_id", "must not be empty")
+		}
+		switch t.ParseMode {
+		case "", "HTML", "MarkdownV2":
+		default:
+			v.errorf("telegram", t.Name, "parse_mode", "unsupported parse mode %q, supported are HTML and MarkdownV2", t.ParseMode)
+		}
+	}
+	for _, w := range c.Webhook {
+		instance("webhook", w.Name, w.Kinds)
+		if w.URL == "" {
+			v.errorf("webhook", w.Name, "url", "must not be empty")
+		}
+		if w.Timeout != "" {
+			d, err := time.ParseDuration(w.Timeout)
+			if err != nil || d <= 0 {
+				v.errorf("webhook", w.Name, "timeout", "invalid duration %q", w.Timeout)
+			}
+			w.timeout = d
+		}
+	}
+	for _, m := range c.SMTP {
+		c.validateSMTP(v, m)
+		instance("smtp", m.Name, m.Kinds)
+	}
+	for _, p := range c.PagerDuty {
+		instance("pagerduty", p.Name, p.Kinds)
+		if p.RoutingKey == "" {
+			v.errorf("pagerduty", p.Name, "routing_key", "must not be empty")
+		}
+	}
+	for _, o := range c.Opsgenie {
+		instance("opsgenie", o.Name, o.Kinds)
+		if o.APIKey == "" {
+			v.errorf("opsgenie", o.Name, "api_key", "must not be empty")
+		}
+		kinds := make([]string, 0, len(o.Priorities))
+		for kind := range o.Priorities {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			if kind != bot.KindDeployment && kind != bot.KindAllocation {
+				v.errorf("opsgenie", o.Name, "priorities", "unknown kind %q, alerts are created for %s and %s", kind, bot.KindDeployment, bot.KindAllocation)
+			}
+			switch o.Priorities[kind] {
+			case "P1", "P2", "P3", "P4", "P5":
+			default:
+				v.errorf("opsgenie", o.Name, "priorities", "invalid priority %q of %s, supported are P1 to P5", o.Priorities[kind], kind)
+			}
+		}
+	}
+	for _, m := range c.Matrix {
+		instance("matrix", m.Name, m.Kinds)
+		if m.HomeserverURL == "" {
+			v.errorf("matrix", m.Name, "homeserver_url", "must not be empty")
+		}
+		if m.AccessToken == "" {
+			v.errorf("matrix", m.Name, "access_token", "must not be empty")
+		}
+		if m.RoomID == "" {
+			v.errorf("matrix", m.Name, "room_id", "must not be empty")
+		}
+	}
+	for _, g := range c.GoogleChat {
+		instance("google_chat", g.Name, g.Kinds)
+		if g.WebhookURL == "" {
+			v.errorf("google_chat", g.Name, "webhook_url", "must not be empty")
+		}
+	}
+	return names
+}
+
+func (c *Config) validateSMTP(v *validator, m *SMTP) {
+	if m.Host == "" {
+		v.errorf("smtp", m.Name, "host", "must not be empty")
+	}
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		v.errorf("smtp", m.Name, "from", "invalid address %q: %s", m.From, err)
+	}
+	for _, addr := range m.To {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			v.errorf("smtp", m.Name, "to", "invalid address %q: %s", addr, err)
+		}
+	}
+	switch m.TLS {
+	case "", "starttls", "tls", "none":
+	default:
+		v.errorf("smtp", m.Name, "tls", "unsupported tls mode %q, supported are starttls, tls and none", m.TLS)
+	}
+	if m.TLSCAFile != "" {
+		if m.TLS == "none" {
+			v.errorf("smtp", m.Name, "tls_ca_file", "is not used with tls = \"none\"")
+		} else if _, err := os.Stat(m.TLSCAFile); err != nil {
+			v.errorf("smtp", m.Name, "tls_ca_file", "%s", err)
+		}
+	}
+	if m.Port < 0 || m.Port > 65535 {
+		v.errorf("smtp", m.Name, "port", "invalid port %d", m.Port)
+	}
+	if m.Digest != "" {
+		d, err := time.ParseDuration(m.Digest)
+		if err != nil || d <= 0 {
+			v.errorf("smtp", m.Name, "digest", "invalid duration %q", m.Digest)
+		}
+		m.digest = d
+	}
+	if len(m.To) == 0 && len(m.Recipients) == 0 {
+		v.errorf("smtp", m.Name, "to", "at least one of to or a recipient block is required")
+	}
+	for _, r := range m.Recipients {
+		if _, err := mail.ParseAddress(r.Address); err != nil {
+			v.errorf("smtp", m.Name, "", "recipient %q: invalid address: %s", r.Address, err)
+		}
+		if r.Filter != "" {
+			if _, err := bexpr.CreateEvaluator(r.Filter); err != nil {
+				v.errorf("smtp", m.Name, "", "recipient %q: invalid filter: %s", r.Address, err)
+			}
+		}
+	}
+}
+
+func (c *Config) validateRoutes(v *validator, instances map[string]string) {
+	targets := func(blockType, label string, targets []string) {
+		for _, t := range targets {
+			if _, ok := instances[t]; !ok {
+				v.errorf(blockType, label, "targets", "unknown target %q, targets are the labels of backend blocks, e.g. slack %q", t, t)
+			}
+		}
+	}
+
+	for _, r := range c.Routes {
+		targets("route", r.Name, r.Targets)
+		if r.Filter != "" {
+			if _, err := bexpr.CreateEvaluator(r.Filter); err != nil {
+				v.errorf("route", r.Name, "filter", "%s", err)
+			}
+		}
+	}
+	if c.DefaultRoute != nil {
+		targets("default_route", "", c.DefaultRoute.Targets)
+	}
+}
+
+var knownKinds = map[string]bool{
+	bot.KindDeployment: true,
+	bot.KindAllocation: true,
+	bot.KindJob:        true,
+	bot.KindNode:       true,
+	bot.KindEvaluation: true,
+	bot.KindService:    true,
+}
+
+func sortedKinds() []string {
+	kinds := make([]string, 0, len(knownKinds))
+	for k := range knownKinds {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func joinKinds(kinds []classify.Kind) string {
+	s := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		s = append(s, string(k))
+	}
+	return strings.Join(s, ", ")
+}
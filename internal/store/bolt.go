@@ -0,0 +1,142 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var messagesBucket = []byte("messages")
+
+type boltRecord struct {
+	MessageID string    `json:"message_id"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// decodeBoltRecord also accepts the plain message IDs written by older versions.
+func decodeBoltRecord(v []byte) boltRecord {
+	var rec boltRecord
+	if err := json.Unmarshal(v, &rec); err != nil {
+		return boltRecord{MessageID: string(v)}
+	}
+	return rec
+}
+
+// Bolt is a MessageStore backed by a local bbolt database file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+func NewBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening bolt db %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(messagesBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error creating bucket: %w", err)
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Get(key Key) (string, bool, error) {
+	var rec boltRecord
+	var ok bool
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(messagesBucket).Get([]byte(key.String()))
+		if v != nil {
+			rec, ok = decodeBoltRecord(v), true
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("error reading message id %s: %w", key, err)
+	}
+	if !ok || expired(rec.ExpiresAt) {
+		return "", false, nil
+	}
+	return rec.MessageID, true, nil
+}
+
+func (b *Bolt) Set(key Key, messageID string, ttl time.Duration) error {
+	v, err := json.Marshal(boltRecord{MessageID: messageID, ExpiresAt: expiresAt(ttl)})
+	if err != nil {
+		return err
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(messagesBucket).Put([]byte(key.String()), v)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving message id %s: %w", key, err)
+	}
+	return nil
+}
+
+func (b *Bolt) Delete(key Key) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(messagesBucket).Delete([]byte(key.String()))
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting message id %s: %w", key, err)
+	}
+	return nil
+}
+
+func (b *Bolt) Prune() (int, error) {
+	removed := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(messagesBucket)
+
+		// collect first, deleting while iterating a cursor skips items
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			if expired(decodeBoltRecord(v).ExpiresAt) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error pruning messages: %w", err)
+	}
+	return removed, nil
+}
+
+func (b *Bolt) Len() (map[string]int, error) {
+	sizes := make(map[string]int)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(messagesBucket).ForEach(func(k, _ []byte) error {
+			sizes[kindOf(string(k))]++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting messages: %w", err)
+	}
+	return sizes, nil
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
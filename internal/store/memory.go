@@ -0,0 +1,124 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	key       Key
+	messageID string
+	expiresAt time.Time
+}
+
+// Memory is a MessageStore that does not survive restarts.
+// Each kind may be bounded, the least recently used entries are evicted first.
+type Memory struct {
+	mu       sync.Mutex
+	capacity map[string]int
+	entries  map[Key]*list.Element
+	// lru holds the entries of each kind, most recently used at the front
+	lru map[string]*list.List
+}
+
+// NewMemory creates a Memory store, capacity limits the number of entries per kind,
+// kinds without a positive limit are unbounded.
+func NewMemory(capacity map[string]int) *Memory {
+	return &Memory{
+		capacity: capacity,
+		entries:  make(map[Key]*list.Element),
+		lru:      make(map[string]*list.List),
+	}
+}
+
+func (m *Memory) Get(key Key) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if expired(entry.expiresAt) {
+		m.remove(el)
+		return "", false, nil
+	}
+
+	m.lru[key.Kind].MoveToFront(el)
+	return entry.messageID, true, nil
+}
+
+func (m *Memory) Set(key Key, messageID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := &memoryEntry{key: key, messageID: messageID, expiresAt: expiresAt(ttl)}
+
+	l, ok := m.lru[key.Kind]
+	if !ok {
+		l = list.New()
+		m.lru[key.Kind] = l
+	}
+
+	if el, ok := m.entries[key]; ok {
+		el.Value = entry
+		l.MoveToFront(el)
+		return nil
+	}
+	m.entries[key] = l.PushFront(entry)
+
+	if limit := m.capacity[key.Kind]; limit > 0 {
+		for l.Len() > limit {
+			m.remove(l.Back())
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Delete(key Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+	return nil
+}
+
+func (m *Memory) Prune() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for _, el := range m.entries {
+		if expired(el.Value.(*memoryEntry).expiresAt) {
+			m.remove(el)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *Memory) Len() (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sizes := make(map[string]int, len(m.lru))
+	for kind, l := range m.lru {
+		sizes[kind] = l.Len()
+	}
+	return sizes, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// remove must be called with mu held.
+func (m *Memory) remove(el *list.Element) {
+	entry := el.Value.(*memoryEntry)
+	m.lru[entry.key.Kind].Remove(el)
+	delete(m.entries, entry.key)
+}
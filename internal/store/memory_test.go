@@ -0,0 +1,34 @@
+package store
+
+import "testing"
+
+func TestMemoryCapacity(t *testing.T) {
+	m := NewMemory(map[string]int{KindAllocation: 2})
+	keys := []Key{
+		{Backend: "slack", Kind: KindAllocation, ID: "a1"},
+		{Backend: "slack", Kind: KindAllocation, ID: "a2"},
+		{Backend: "slack", Kind: KindAllocation, ID: "a3"},
+	}
+	_ = m.Set(keys[0], "m1", 0)
+	_ = m.Set(keys[1], "m2", 0)
+	// using a1 makes a2 the least recently used one
+	_, _, _ = m.Get(keys[0])
+	_ = m.Set(keys[2], "m3", 0)
+
+	if _, ok, _ := m.Get(keys[1]); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, k := range []Key{keys[0], keys[2]} {
+		if _, ok, _ := m.Get(k); !ok {
+			t.Errorf("%s was evicted", k)
+		}
+	}
+
+	// other kinds are unbounded
+	for i := 0; i < 10; i++ {
+		_ = m.Set(Key{Backend: "slack", Kind: KindDeployment, ID: string(rune('a' + i))}, "m", 0)
+	}
+	if sizes, _ := m.Len(); sizes[KindDeployment] != 10 || sizes[KindAllocation] != 2 {
+		t.Errorf("Len() = %v, want 10 deployments and 2 allocations", sizes)
+	}
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+const (
+	messageIDItem = "message_id"
+	expiresAtItem = "expires_at"
+)
+
+// variablePathRe matches the variable paths nomad accepts.
+var variablePathRe = regexp.MustCompile(`^[a-zA-Z0-9-_~/]{1,128}$`)
+
+// NomadVariables is a MessageStore backed by Nomad Variables,
+// useful when the notifier runs as a nomad job without a persistent volume.
+// Each message ID is saved as one variable under prefix.
+type NomadVariables struct {
+	vars      *api.Variables
+	prefix    string
+	namespace string
+
+	mu sync.Mutex
+	// expiries caches the expiry of each variable by path. The list call only
+	// returns metadata, so an entry is trusted as long as the modify index
+	// listed for the variable is the one it was read at.
+	expiries map[string]variableExpiry
+}
+
+type variableExpiry struct {
+	modifyIndex uint64
+	expiresAt   time.Time
+}
+
+func NewNomadVariables(client *api.Client, prefix, namespace string) *NomadVariables {
+	return &NomadVariables{
+		vars:      client.Variables(),
+		prefix:    prefix,
+		namespace: namespace,
+		expiries:  make(map[string]variableExpiry),
+	}
+}
+
+// path returns the variable path of key. IDs nomad does not accept in a path,
+// e.g. job IDs with dots or too long ones, are replaced by a hash of them.
+func (n *NomadVariables) path(key Key) string {
+	p := path.Join(n.prefix, key.Backend, key.Kind, key.ID)
+	if variablePathRe.MatchString(p) {
+		return p
+	}
+	sum := sha256.Sum256([]byte(key.ID))
+	return path.Join(n.prefix, key.Backend, key.Kind, hex.EncodeToString(sum[:16]))
+}
+
+// items returns the items of the variable at p, nil if it does not exist.
+func (n *NomadVariables) items(p string) (api.VariableItems, error) {
+	items, _, err := n.vars.GetVariableItems(p, &api.QueryOptions{Namespace: n.namespace})
+	if err != nil {
+		if errors.Is(err, api.ErrVariablePathNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading variable %s: %w", p, err)
+	}
+	return items, nil
+}
+
+// itemsExpiry returns the expiry saved in items, the zero time if there is none.
+func itemsExpiry(items api.VariableItems) time.Time {
+	deadline, err := time.Parse(time.RFC3339, items[expiresAtItem])
+	if err != nil {
+		return time.Time{}
+	}
+	return deadline
+}
+
+func (n *NomadVariables) remember(p string, modifyIndex uint64, deadline time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.expiries[p] = variableExpiry{modifyIndex: modifyIndex, expiresAt: deadline}
+}
+
+func (n *NomadVariables) forget(p string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.expiries, p)
+}
+
+// expiry returns the expiry of the listed variable, it is only read
+// from nomad if the variable changed since it was last seen.
+func (n *NomadVariables) expiry(meta *api.VariableMetadata) (time.Time, error) {
+	n.mu.Lock()
+	cached, ok := n.expiries[meta.Path]
+	n.mu.Unlock()
+	if ok && cached.modifyIndex == meta.ModifyIndex {
+		return cached.expiresAt, nil
+	}
+
+	v, _, err := n.vars.Peek(meta.Path, &api.QueryOptions{Namespace: n.namespace})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading variable %s: %w", meta.Path, err)
+	}
+	if v == nil {
+		n.forget(meta.Path)
+		return time.Time{}, nil
+	}
+	deadline := itemsExpiry(v.Items)
+	n.remember(meta.Path, v.ModifyIndex, deadline)
+	return deadline, nil
+}
+
+func (n *NomadVariables) Get(key Key) (string, bool, error) {
+	items, err := n.items(n.path(key))
+	if err != nil || items == nil || expired(itemsExpiry(items)) {
+		return "", false, err
+	}
+
+	messageID, ok := items[messageIDItem]
+	return messageID, ok, nil
+}
+
+func (n *NomadVariables) Set(key Key, messageID string, ttl time.Duration) error {
+	items := api.VariableItems{messageIDItem: messageID}
+	deadline := expiresAt(ttl)
+	if !deadline.IsZero() {
+		items[expiresAtItem] = deadline.Format(time.RFC3339)
+	}
+
+	v := &api.Variable{
+		Namespace: n.namespace,
+		Path:      n.path(key),
+		Items:     items,
+	}
+	created, _, err := n.vars.Create(v, &api.WriteOptions{Namespace: n.namespace})
+	if err != nil {
+		return fmt.Errorf("error writing variable %s: %w", v.Path, err)
+	}
+	if created != nil {
+		n.remember(v.Path, created.ModifyIndex, deadline.Truncate(time.Second))
+	}
+	return nil
+}
+
+func (n *NomadVariables) Delete(key Key) error {
+	if _, err := n.vars.Delete(n.path(key), &api.WriteOptions{Namespace: n.namespace}); err != nil {
+		return fmt.Errorf("error deleting variable %s: %w", n.path(key), err)
+	}
+	n.forget(n.path(key))
+	return nil
+}
+
+func (n *NomadVariables) list() ([]*api.VariableMetadata, error) {
+	metas, _, err := n.vars.PrefixList(n.prefix+"/", &api.QueryOptions{Namespace: n.namespace})
+	if err != nil {
+		return nil, fmt.Errorf("error listing variables %s: %w", n.prefix, err)
+	}
+	return metas, nil
+}
+
+// Prune lists the variables under prefix and deletes the expired ones.
+// The expiry is only known from the items, which are read once per variable
+// version, so a prune without writes since the last one costs a single list call.
+func (n *NomadVariables) Prune() (int, error) {
+	metas, err := n.list()
+	if err != nil {
+		return 0, err
+	}
+
+	listed := make(map[string]bool, len(metas))
+	removed := 0
+	for _, meta := range metas {
+		listed[meta.Path] = true
+		deadline, err := n.expiry(meta)
+		if err != nil {
+			return removed, err
+		}
+		if !expired(deadline) {
+			continue
+		}
+		if _, err := n.vars.Delete(meta.Path, &api.WriteOptions{Namespace: n.namespace}); err != nil {
+			return removed, fmt.Errorf("error deleting variable %s: %w", meta.Path, err)
+		}
+		n.forget(meta.Path)
+		removed++
+	}
+
+	// drop the variables deleted by someone else
+	n.mu.Lock()
+	for p := range n.expiries {
+		if !listed[p] {
+			delete(n.expiries, p)
+		}
+	}
+	n.mu.Unlock()
+	return removed, nil
+}
+
+func (n *NomadVariables) Len() (map[string]int, error) {
+	metas, err := n.list()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int)
+	for _, meta := range metas {
+		sizes[kindOf(strings.TrimPrefix(meta.Path, n.prefix+"/"))]++
+	}
+	return sizes, nil
+}
+
+func (n *NomadVariables) Close() error {
+	return nil
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// fakeVariables serves the variables endpoints of the nomad api from memory.
+type fakeVariables struct {
+	mu    sync.Mutex
+	vars  map[string]api.VariableItems
+	index map[string]uint64
+	last  uint64
+	// reads counts the variables read
+	reads int
+}
+
+func newFakeVariables() *fakeVariables {
+	return &fakeVariables{vars: make(map[string]api.VariableItems), index: make(map[string]uint64)}
+}
+
+func (f *fakeVariables) put(path string, items api.VariableItems) uint64 {
+	f.last++
+	f.vars[path] = items
+	f.index[path] = f.last
+	return f.last
+}
+
+func (f *fakeVariables) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("X-Nomad-Index", "1")
+	w.Header().Set("X-Nomad-KnownLeader", "true")
+	w.Header().Set("X-Nomad-LastContact", "0")
+
+	if r.URL.Path == "/v1/vars" {
+		prefix := r.URL.Query().Get("prefix")
+		metas := []api.VariableMetadata{}
+		for path := range f.vars {
+			if strings.HasPrefix(path, prefix) {
+				metas = append(metas, api.VariableMetadata{Path: path, ModifyIndex: f.index[path]})
+			}
+		}
+		sort.Slice(metas, func(i, j int) bool { return metas[i].Path < metas[j].Path })
+		_ = json.NewEncoder(w).Encode(metas)
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/v1/var/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, ok := f.vars[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.reads++
+		_ = json.NewEncoder(w).Encode(api.Variable{Path: path, Items: items, ModifyIndex: f.index[path]})
+	case http.MethodPut:
+		if !variablePathRe.MatchString(path) {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+		var v api.Variable
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		v.ModifyIndex = f.put(path, v.Items)
+		_ = json.NewEncoder(w).Encode(v)
+	case http.MethodDelete:
+		delete(f.vars, path)
+		delete(f.index, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestNomadVariables(t *testing.T) {
+	fake := newFakeVariables()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := api.NewClient(&api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, NewNomadVariables(client, "nomad-event-notifier", "default"))
+
+	if _, ok := fake.vars["nomad-event-notifier/discord/deployment/d1"]; !ok {
+		t.Errorf("variables = %v, want nomad-event-notifier/discord/deployment/d1", fake.vars)
+	}
+}
+
+func TestNomadVariablesInvalidPathIDs(t *testing.T) {
+	fake := newFakeVariables()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := api.NewClient(&api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewNomadVariables(client, "nomad-event-notifier", "default")
+
+	keys := []Key{
+		{Backend: "pagerduty", Kind: "incident", ID: "default/web.frontend"},
+		{Backend: "pagerduty", Kind: "incident", ID: "default/web_frontend"},
+		{Backend: "opsgenie", Kind: "incident", ID: "platform-team/" + strings.Repeat("payments-gateway-", 8)},
+	}
+	for i, key := range keys {
+		if err := n.Set(key, fmt.Sprintf("alert%d", i), time.Hour); err != nil {
+			t.Fatalf("Set(%s) = %v", key, err)
+		}
+	}
+	for i, key := range keys {
+		if id, ok, err := n.Get(key); err != nil || !ok || id != fmt.Sprintf("alert%d", i) {
+			t.Errorf("Get(%s) = %q, %v, %v, want alert%d", key, id, ok, err, i)
+		}
+	}
+
+	sizes, err := n.Len()
+	if err != nil || sizes["incident"] != 3 {
+		t.Errorf("Len() = %v, %v, want 3 incidents", sizes, err)
+	}
+	for _, key := range keys {
+		if err := n.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok, _ := n.Get(key); ok {
+			t.Errorf("Get(%s) after Delete() found", key)
+		}
+	}
+}
+
+func TestNomadVariablesPruneReadsChangedOnly(t *testing.T) {
+	fake := newFakeVariables()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := api.NewClient(&api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewNomadVariables(client, "nomad-event-notifier", "default")
+	for _, id := range []string{"d1", "d2", "d3"} {
+		if err := n.Set(Key{Backend: "slack", Kind: KindDeployment, ID: id}, "m", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// written by another notifier sharing the prefix, already expired
+	fake.mu.Lock()
+	fake.put("nomad-event-notifier/slack/deployment/d4", api.VariableItems{
+		messageIDItem: "m",
+		expiresAtItem: time.Now().Add(-time.Minute).Format(time.RFC3339),
+	})
+	fake.mu.Unlock()
+
+	prune := func(wantRemoved, wantReads int) {
+		t.Helper()
+		fake.mu.Lock()
+		fake.reads = 0
+		fake.mu.Unlock()
+		removed, err := n.Prune()
+		if err != nil || removed != wantRemoved {
+			t.Fatalf("Prune() = %d, %v, want %d", removed, err, wantRemoved)
+		}
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		if fake.reads != wantReads {
+			t.Errorf("Prune() read %d variables, want %d", fake.reads, wantReads)
+		}
+	}
+	prune(1, 1)
+	prune(0, 0)
+
+	// changed by someone else, so its cached expiry is stale
+	fake.mu.Lock()
+	fake.put("nomad-event-notifier/slack/deployment/d2", api.VariableItems{
+		messageIDItem: "m",
+		expiresAtItem: time.Now().Add(-time.Minute).Format(time.RFC3339),
+	})
+	fake.mu.Unlock()
+	prune(1, 1)
+	prune(0, 0)
+}
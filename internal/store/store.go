@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	KindDeployment = "deployment"
+	KindAllocation = "allocation"
+)
+
+var (
+	entriesVar = expvar.NewMap("message_store_entries")
+	prunedVar  = expvar.NewInt("message_store_pruned")
+)
+
+// Key identifies the platform message posted for one nomad object on one backend.
+type Key struct {
+	// Backend is the name of the bot backend, e.g. "slack" or "discord"
+	Backend string
+	// Kind is the kind of nomad object, e.g. KindDeployment or KindAllocation
+	Kind string
+	// ID is the nomad object ID
+	ID string
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s/%s/%s", k.Backend, k.Kind, k.ID)
+}
+
+// kindOf returns the kind part of a key formatted by Key.String.
+func kindOf(key string) string {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// MessageStore maps nomad objects to the platform message IDs posted for them,
+// so that messages keep being updated instead of re-posted, even across restarts.
+type MessageStore interface {
+	// Get returns the message ID saved for key, ok is false if there is none or it expired.
+	Get(key Key) (messageID string, ok bool, err error)
+	// Set saves the message ID for key, it expires after ttl unless ttl is zero.
+	Set(key Key, messageID string, ttl time.Duration) error
+	Delete(key Key) error
+	// Prune removes expired entries and returns how many were removed.
+	Prune() (int, error)
+	// Len returns the number of entries per kind.
+	Len() (map[string]int, error)
+	Close() error
+}
+
+// expiresAt returns the deadline for ttl, the zero time if ttl is zero.
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+// RunJanitor prunes expired entries every interval and publishes
+// the store size to the logs and the message_store_entries expvar, until ctx is done.
+func RunJanitor(ctx context.Context, s MessageStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		removed, err := s.Prune()
+		if err != nil {
+			slog.Warn("error pruning message store", "error", err)
+		}
+		prunedVar.Add(int64(removed))
+
+		sizes, err := s.Len()
+		if err != nil {
+			slog.Warn("error counting message store entries", "error", err)
+			continue
+		}
+		for kind, n := range sizes {
+			v := new(expvar.Int)
+			v.Set(int64(n))
+			entriesVar.Set(kind, v)
+		}
+		slog.Info("message store pruned", "removed", removed, "entries", sizes)
+	}
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStore runs the behavior every MessageStore shares against s.
+func testStore(t *testing.T, s MessageStore) {
+	t.Helper()
+	defer s.Close()
+
+	deploy := Key{Backend: "slack", Kind: KindDeployment, ID: "d1"}
+	alloc := Key{Backend: "slack", Kind: KindAllocation, ID: "a1"}
+	other := Key{Backend: "discord", Kind: KindDeployment, ID: "d1"}
+
+	if _, ok, err := s.Get(deploy); err != nil || ok {
+		t.Fatalf("Get() of missing key = %v, %v, want not found", ok, err)
+	}
+
+	if err := s.Set(deploy, "m1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(other, "m2", 0); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok, err := s.Get(deploy); err != nil || !ok || id != "m1" {
+		t.Fatalf("Get() = %q, %v, %v, want m1", id, ok, err)
+	}
+	if id, ok, err := s.Get(other); err != nil || !ok || id != "m2" {
+		t.Fatalf("Get() of other backend = %q, %v, %v, want m2", id, ok, err)
+	}
+
+	if err := s.Set(deploy, "m3", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if id, _, _ := s.Get(deploy); id != "m3" {
+		t.Fatalf("Get() after overwrite = %q, want m3", id)
+	}
+
+	if err := s.Set(alloc, "m4", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, err := s.Get(alloc); err != nil || ok {
+		t.Fatalf("Get() of expired key = %v, %v, want not found", ok, err)
+	}
+
+	if err := s.Set(alloc, "m4", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	removed, err := s.Prune()
+	if err != nil || removed != 1 {
+		t.Fatalf("Prune() = %d, %v, want 1", removed, err)
+	}
+
+	sizes, err := s.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes[KindDeployment] != 2 || sizes[KindAllocation] != 0 {
+		t.Errorf("Len() = %v, want 2 deployments and no allocations", sizes)
+	}
+
+	if err := s.Delete(deploy); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Get(deploy); err != nil || ok {
+		t.Fatalf("Get() after Delete() = %v, %v, want not found", ok, err)
+	}
+	if err := s.Delete(deploy); err != nil {
+		t.Fatalf("Delete() of missing key = %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory(nil))
+}
+
+func TestBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	b, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, b)
+
+	// entries survive reopening the database
+	b, err = NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	key := Key{Backend: "discord", Kind: KindDeployment, ID: "d1"}
+	if id, ok, err := b.Get(key); err != nil || !ok || id != "m2" {
+		t.Fatalf("Get() after reopen = %q, %v, %v, want m2", id, ok, err)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := map[string]string{
+		"slack/deployment/d1":     KindDeployment,
+		"pd/incident/default/web": "incident",
+		"slack/allocation":        "",
+		"":                        "",
+	}
+	for key, want := range tests {
+		if got := kindOf(key); got != want {
+			t.Errorf("kindOf(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
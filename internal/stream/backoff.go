@@ -0,0 +1,35 @@
+package stream
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// backoff computes exponentially growing delays with jitter,
+// so a fleet of notifiers does not reconnect to a new leader in lockstep.
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func newBackoff(minDelay, maxDelay time.Duration) *backoff {
+	return &backoff{min: minDelay, max: maxDelay}
+}
+
+// next returns the delay before the next attempt,
+// a random value between half and all of min * 2^attempt, capped at max.
+func (b *backoff) next() time.Duration {
+	d := b.max
+	if b.attempt < 32 {
+		d = min(b.min<<b.attempt, b.max)
+	}
+	b.attempt++
+
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,35 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, time.Minute)
+
+	for attempt, want := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second,
+		time.Minute, time.Minute,
+	} {
+		got := b.next()
+		if got < want/2 || got > want {
+			t.Errorf("attempt %d: got %v, want between %v and %v", attempt, got, want/2, want)
+		}
+	}
+
+	b.reset()
+	if got := b.next(); got > time.Second {
+		t.Errorf("after reset: got %v, want at most 1s", got)
+	}
+}
+
+func TestBackoffCapped(t *testing.T) {
+	b := newBackoff(time.Second, time.Minute)
+	// shifting by the attempt must not overflow after many failures
+	for i := 0; i < 100; i++ {
+		if got := b.next(); got <= 0 || got > time.Minute {
+			t.Fatalf("attempt %d: got %v, want in (0, 1m]", i, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records the last processed event index so that a restarted
+// notifier can resume the event stream where it left off.
+type Checkpoint interface {
+	// Load returns the last saved index and the time it was saved.
+	// A zero index means nothing has been saved yet.
+	Load() (index uint64, savedAt time.Time, err error)
+	Save(index uint64) error
+}
+
+type checkpointState struct {
+	Index   uint64    `json:"index"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// FileCheckpoint stores the index as a small json document on local disk.
+type FileCheckpoint struct {
+	path string
+}
+
+func NewFileCheckpoint(path string) (*FileCheckpoint, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating checkpoint dir: %w", err)
+	}
+	return &FileCheckpoint{path: path}, nil
+}
+
+func (c *FileCheckpoint) Load() (uint64, time.Time, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, time.Time{}, fmt.Errorf("error decoding checkpoint %s: %w", c.path, err)
+	}
+	return state.Index, state.SavedAt, nil
+}
+
+// Save writes the index to a temp file and renames it into place,
+// so a crash mid-write never leaves a truncated checkpoint behind.
+func (c *FileCheckpoint) Save(index uint64) error {
+	data, err := json.Marshal(checkpointState{Index: index, SavedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("error replacing checkpoint: %w", err)
+	}
+	return nil
+}
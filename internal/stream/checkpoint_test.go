@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestFileCheckpoint(t *testing.T) {
+	c, err := NewFileCheckpoint(filepath.Join(t.TempDir(), "data", "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, _, err := c.Load()
+	if err != nil || index != 0 {
+		t.Fatalf("Load() without checkpoint = %d, %v, want 0, nil", index, err)
+	}
+
+	if err := c.Save(42); err != nil {
+		t.Fatal(err)
+	}
+	index, savedAt, err := c.Load()
+	if err != nil || index != 42 {
+		t.Fatalf("Load() = %d, %v, want 42, nil", index, err)
+	}
+	if time.Since(savedAt) > time.Minute {
+		t.Errorf("savedAt = %v, want now", savedAt)
+	}
+}
+
+type staticCheckpoint struct {
+	index   uint64
+	savedAt time.Time
+}
+
+func (c staticCheckpoint) Load() (uint64, time.Time, error) { return c.index, c.savedAt, nil }
+func (c staticCheckpoint) Save(uint64) error                { return nil }
+
+func TestStartIndex(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name        string
+		checkpoint  Checkpoint
+		maxLookback time.Duration
+		want        uint64
+	}{
+		{"no checkpoint", nil, 0, math.MaxInt64},
+		{"nothing saved", staticCheckpoint{}, 0, math.MaxInt64},
+		{"resume", staticCheckpoint{10, time.Now()}, 10 * time.Minute, 11},
+		{"too old", staticCheckpoint{10, old}, 10 * time.Minute, math.MaxInt64},
+		{"no limit", staticCheckpoint{10, old}, 0, 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStream(api.DefaultConfig(), Config{Checkpoint: tt.checkpoint, MaxLookback: tt.maxLookback})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.startIndex(); got != tt.want {
+				t.Errorf("startIndex() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCheckpointRefreshedWhileQuiet restarts the notifier after a quiet period longer than the
+// max look-back, the checkpoint must still be resumed from as the stream was connected all along.
+func TestCheckpointRefreshedWhileQuiet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/event/stream" {
+			http.NotFound(w, r)
+			return
+		}
+		for {
+			if _, err := w.Write([]byte("{}\n")); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	data, _ := json.Marshal(checkpointState{Index: 10, SavedAt: time.Now().Add(-time.Hour)})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewFileCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{Checkpoint: c, MaxLookback: 10 * time.Minute}
+
+	s, err := NewStream(&api.Config{Address: srv.URL}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.refresh = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.subscribeOnce(ctx, nil, 11)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		index, savedAt, err := c.Load()
+		if err == nil && time.Since(savedAt) < time.Minute {
+			if index != 10 {
+				t.Errorf("refreshed checkpoint index = %d, want 10", index)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("checkpoint not refreshed while connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	restarted, err := NewStream(&api.Config{Address: srv.URL}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.startIndex(); got != 11 {
+		t.Errorf("startIndex() after restart = %d, want 11", got)
+	}
+}
@@ -3,10 +3,11 @@ package stream
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"log/slog"
 	"math"
-	"os"
 	"time"
 
 	"github.com/hashicorp/nomad/api"
@@ -14,100 +15,277 @@ import (
 	"github.com/ttys3/nomad-event-notifier/internal/bot"
 )
 
+var (
+	reconnectsVar = expvar.NewInt("stream_reconnects")
+	lastIndexVar  = expvar.NewInt("stream_last_index")
+)
+
+type Config struct {
+	// Topics maps event topics to their filter keys, defaults to DefaultTopics
+	Topics map[api.Topic][]string
+	// Namespace to stream events from, "*" for all, empty for the client default
+	Namespace string
+	// Checkpoint persists the last processed event index, nil disables resuming.
+	Checkpoint Checkpoint
+	// MaxLookback is the oldest checkpoint we are willing to resume from,
+	// older ones start from the latest index instead of replaying stale events.
+	// Zero means no limit.
+	MaxLookback time.Duration
+}
+
 type Stream struct {
 	nomad *api.Client
-	L     *slog.Logger
+	cfg   Config
+	// refresh is how often the checkpoint is re-saved while the stream is connected but quiet
+	refresh time.Duration
+	L       *slog.Logger
 }
 
-func NewStream(config *api.Config) (*Stream, error) {
+func NewStream(config *api.Config, cfg Config) (*Stream, error) {
 	client, err := api.NewClient(config)
 	if err != nil {
 		return nil, fmt.Errorf("error creating nomad client: %w", err)
 	}
+	if len(cfg.Topics) == 0 {
+		cfg.Topics = DefaultTopics
+	}
 	return &Stream{
-		nomad: client,
-		L:     slog.Default(),
+		nomad:   client,
+		cfg:     cfg,
+		refresh: time.Minute,
+		L:       slog.Default(),
 	}, nil
 }
 
-// https://www.nomadproject.io/api-docs/events
+// startIndex returns the index to start streaming from.
+// If the requested index is no longer in the buffer the stream will start at the next available index.
+// Without a usable checkpoint we use math.MaxInt64 to avoid duplicated items each time server restart.
+func (s *Stream) startIndex() uint64 {
+	if s.cfg.Checkpoint == nil {
+		return math.MaxInt64
+	}
+
+	index, savedAt, err := s.cfg.Checkpoint.Load()
+	if err != nil {
+		s.L.Warn("error loading checkpoint, starting from latest index", "error", err)
+		return math.MaxInt64
+	}
+	if index == 0 {
+		s.L.Info("no checkpoint found, starting from latest index")
+		return math.MaxInt64
+	}
+	if s.cfg.MaxLookback > 0 && time.Since(savedAt) > s.cfg.MaxLookback {
+		s.L.Info("checkpoint is older than max look-back, starting from latest index",
+			"index", index, "saved_at", savedAt, "max_lookback", s.cfg.MaxLookback)
+		return math.MaxInt64
+	}
+
+	s.L.Info("resuming event stream from checkpoint", "index", index, "saved_at", savedAt)
+	return index + 1
+}
+
+func (s *Stream) saveCheckpoint(index uint64) {
+	if s.cfg.Checkpoint == nil {
+		return
+	}
+	if err := s.cfg.Checkpoint.Save(index); err != nil {
+		s.L.Warn("error saving checkpoint", "index", index, "error", err)
+	}
+}
+
+// Subscribe streams events to the bot until ctx is cancelled.
+// Whenever the stream fails or is closed by the server (e.g. on leader election)
+// it reconnects with jittered exponential backoff, resuming from the last seen index.
 func (s *Stream) Subscribe(ctx context.Context, b *bot.Bot) {
-	events := s.nomad.EventStream()
+	index := s.startIndex()
+	bo := newBackoff(time.Second, 2*time.Minute)
 
-	// Topic: Node, Job, Evaluation, Allocation, Deployment
-	// event topic: job
-	topics := map[api.Topic][]string{
-		api.Topic("Deployment"): {"*"},
-		api.Topic("Allocation"): {"*"},
-		// api.Topic("Job"):        {"*"},
+	for {
+		connectedAt := time.Now()
+		lastIndex, err := s.subscribeOnce(ctx, b, index)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if lastIndex > 0 {
+			index = lastIndex + 1
+		}
+		// only keep backing off when the stream keeps failing right away
+		if lastIndex > 0 || time.Since(connectedAt) > time.Minute {
+			bo.reset()
+		}
+
+		wait := bo.next()
+		reconnectsVar.Add(1)
+		s.L.Warn("event stream disconnected, reconnecting", "error", err, "index", index,
+			"attempt", bo.attempt, "backoff", wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
 	}
+}
+
+// subscribeOnce runs a single event stream connection until it fails.
+// It returns the index of the last processed events, zero if none.
+//
+// https://www.nomadproject.io/api-docs/events
+func (s *Stream) subscribeOnce(ctx context.Context, b *bot.Bot, index uint64) (uint64, error) {
+	// cancel the stream goroutine of the api client when we give up on this connection
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := s.nomad.EventStream()
 
 	// index (int: 0) - Specifies the index to start streaming events from.
-	// If the requested index is no longer in the buffer the stream will start at the next available index.
-	// hack: use math.MaxInt64 to avoid duplicated items each time server restart
-	eventCh, err := events.Stream(ctx, topics, math.MaxInt64, &api.QueryOptions{})
+	eventCh, err := events.Stream(ctx, s.cfg.Topics, index, &api.QueryOptions{Namespace: s.cfg.Namespace})
 	if err != nil {
-		s.L.Error("error creating event stream client", "error", err)
-		os.Exit(1)
+		return 0, fmt.Errorf("error creating event stream client: %w", err)
+	}
+	s.L.Info("event stream connected", "index", index, "topics", s.cfg.Topics, "namespace", s.cfg.Namespace)
+
+	// The checkpoint's saved_at has to tell when we were last alive, not when the cluster was last busy,
+	// otherwise a restart after a quiet period longer than the max look-back drops the events missed meanwhile.
+	// The api client swallows heartbeats, so re-save the last processed index periodically instead.
+	var savedIndex uint64
+	if index != math.MaxInt64 {
+		savedIndex = index - 1
 	}
+	refresh := time.NewTicker(s.refresh)
+	defer refresh.Stop()
 
+	var lastIndex uint64
 	for {
 		select {
 		case <-ctx.Done():
-			return
-		case event := <-eventCh:
+			return lastIndex, ctx.Err()
+		case <-refresh.C:
+			if savedIndex > 0 {
+				s.saveCheckpoint(savedIndex)
+			}
+		case event, ok := <-eventCh:
+			if !ok {
+				return lastIndex, errors.New("event stream closed")
+			}
 			if event.Err != nil {
-				s.L.Warn("error from event stream", "error", event.Err)
-				break
+				return lastIndex, fmt.Errorf("error from event stream: %w", event.Err)
 			}
 			if event.IsHeartbeat() {
 				s.L.Info("got heartbeat")
 				continue
 			}
 
-			// Topic: Node, Job, Evaluation, Allocation, Deployment
-			for _, e := range event.Events {
-				eventJson, _ := json.Marshal(e)
-				s.L.Info("got event", "topic", e.Topic, "evt_type", e.Type, "event", string(eventJson))
-
-				switch e.Topic {
-				case "Allocation":
-					// PlanResult, AllocationUpdated, AllocationUpdateDesiredStatus
-					alloc, err := e.Allocation()
-					if err != nil {
-						s.L.Error("decode Payload as Allocation failed", "error", err)
-						continue
-					}
-
-					if alloc != nil {
-						allocJson, _ := json.Marshal(alloc)
-						s.L.Info("got Allocation", "allocation", string(allocJson))
-						if err = b.UpsertAllocationMsg(*alloc); err != nil {
-							s.L.Warn("error UpsertAllocationMsg", "error", err)
-							continue
-						}
-					}
-				case "Deployment":
-					deployment, err := e.Deployment()
-					if err != nil {
-						s.L.Error("decode Payload as Deployment failed", "error", err)
-						continue
-					}
-					if deployment == nil {
-						s.L.Error("nil deployment")
-						continue
-					}
-
-					deploymentJson, _ := json.Marshal(deployment)
-					s.L.Info("got Deployment", "deployment", string(deploymentJson))
-					if err = b.UpsertDeployMsg(*deployment); err != nil {
-						s.L.Warn("error UpsertDeployMsg", "error", err)
-						continue
-					}
+			s.handleEvents(b, event)
+			s.saveCheckpoint(event.Index)
+			savedIndex = event.Index
+			lastIndex = event.Index
+			lastIndexVar.Set(int64(event.Index))
+		}
+	}
+}
+
+func (s *Stream) handleEvents(b *bot.Bot, event *api.Events) {
+	// Topic: Node, Job, Evaluation, Allocation, Deployment
+	for _, e := range event.Events {
+		eventJson, _ := json.Marshal(e)
+		s.L.Info("got event", "topic", e.Topic, "evt_type", e.Type, "event", string(eventJson))
+
+		switch e.Topic {
+		case api.TopicAllocation:
+			// PlanResult, AllocationUpdated, AllocationUpdateDesiredStatus
+			alloc, err := e.Allocation()
+			if err != nil {
+				s.L.Error("decode Payload as Allocation failed", "error", err)
+				continue
+			}
+
+			if alloc != nil {
+				allocJson, _ := json.Marshal(alloc)
+				s.L.Info("got Allocation", "allocation", string(allocJson))
+				if err = b.UpsertAllocationMsg(*alloc); err != nil {
+					s.L.Warn("error UpsertAllocationMsg", "error", err)
+					continue
 				}
 			}
-		default:
-			time.Sleep(time.Millisecond * 100)
-		} // end select
-	} // end for
+		case api.TopicDeployment:
+			deployment, err := e.Deployment()
+			if err != nil {
+				s.L.Error("decode Payload as Deployment failed", "error", err)
+				continue
+			}
+			if deployment == nil {
+				s.L.Error("nil deployment")
+				continue
+			}
+
+			deploymentJson, _ := json.Marshal(deployment)
+			s.L.Info("got Deployment", "deployment", string(deploymentJson))
+			if err = b.UpsertDeployMsg(*deployment); err != nil {
+				s.L.Warn("error UpsertDeployMsg", "error", err)
+				continue
+			}
+		case api.TopicJob:
+			// JobRegistered, JobDeregistered, JobBatchDeregistered
+			job, err := e.Job()
+			if err != nil {
+				s.L.Error("decode Payload as Job failed", "error", err)
+				continue
+			}
+			if job == nil {
+				s.L.Error("nil job")
+				continue
+			}
+			if err = b.UpsertJobMsg(e.Type, *job); err != nil {
+				s.L.Warn("error UpsertJobMsg", "error", err)
+				continue
+			}
+		case api.TopicNode:
+			// NodeRegistration, NodeDeregistration, NodeEligibility, NodeDrain, NodeStreamEvent
+			node, err := e.Node()
+			if err != nil {
+				s.L.Error("decode Payload as Node failed", "error", err)
+				continue
+			}
+			if node == nil {
+				s.L.Error("nil node")
+				continue
+			}
+			if err = b.UpsertNodeMsg(e.Type, *node); err != nil {
+				s.L.Warn("error UpsertNodeMsg", "error", err)
+				continue
+			}
+		case api.TopicEvaluation:
+			// EvaluationUpdated
+			eval, err := e.Evaluation()
+			if err != nil {
+				s.L.Error("decode Payload as Evaluation failed", "error", err)
+				continue
+			}
+			if eval == nil {
+				s.L.Error("nil evaluation")
+				continue
+			}
+			if err = b.UpsertEvalMsg(e.Type, *eval); err != nil {
+				s.L.Warn("error UpsertEvalMsg", "error", err)
+				continue
+			}
+		case api.TopicService:
+			// ServiceRegistration, ServiceDeregistration
+			service, err := e.Service()
+			if err != nil {
+				s.L.Error("decode Payload as Service failed", "error", err)
+				continue
+			}
+			if service == nil {
+				s.L.Error("nil service")
+				continue
+			}
+			if err = b.UpsertServiceMsg(e.Type, *service); err != nil {
+				s.L.Warn("error UpsertServiceMsg", "error", err)
+				continue
+			}
+		}
+	}
 }
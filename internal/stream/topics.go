@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// DefaultTopics is used when no topics are configured.
+var DefaultTopics = map[api.Topic][]string{
+	api.TopicDeployment: {"*"},
+	api.TopicAllocation: {"*"},
+}
+
+var knownTopics = map[api.Topic]bool{
+	api.TopicDeployment: true,
+	api.TopicAllocation: true,
+	api.TopicJob:        true,
+	api.TopicNode:       true,
+	api.TopicEvaluation: true,
+	api.TopicService:    true,
+}
+
+// ParseTopics parses a comma separated list of "Topic:FilterKey" pairs,
+// e.g. "Deployment:*,Job:web,Job:api,Node:*".
+// The filter key is a job ID for Job, Deployment, Allocation and Evaluation,
+// a node ID for Node and a service name for Service. It defaults to "*".
+func ParseTopics(s string) (map[api.Topic][]string, error) {
+	topics := make(map[api.Topic][]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, key, _ := strings.Cut(item, ":")
+		topic := api.Topic(strings.TrimSpace(name))
+		if !knownTopics[topic] {
+			return nil, fmt.Errorf("unsupported event topic %q", topic)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			key = "*"
+		}
+		topics[topic] = append(topics[topic], key)
+	}
+
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no event topics in %q", s)
+	}
+	return topics, nil
+}
@@ -0,0 +1,39 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestParseTopics(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[api.Topic][]string
+		wantErr bool
+	}{
+		{
+			in:   "Deployment:*,Job:web, Job:api ,Node",
+			want: map[api.Topic][]string{api.TopicDeployment: {"*"}, api.TopicJob: {"web", "api"}, api.TopicNode: {"*"}},
+		},
+		{
+			in:   "Service:redis,,Evaluation:",
+			want: map[api.Topic][]string{api.TopicService: {"redis"}, api.TopicEvaluation: {"*"}},
+		},
+		{in: "Volume:*", wantErr: true},
+		{in: "deployment:*", wantErr: true},
+		{in: "", wantErr: true},
+		{in: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTopics(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTopics(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTopics(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}